@@ -0,0 +1,74 @@
+package live
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// accessLog wraps next, logging every request once it has been served. The
+// reload streams at streams are logged as they connect and disconnect instead.
+func accessLog(next http.Handler, log *slog.Logger, streams ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		if slices.Contains(streams, req.URL.Path) {
+			log.Info(fmt.Sprintf("⟳ %s %s connected", req.Method, req.URL.Path),
+				"event", "request", "method", req.Method, "path", req.URL.Path, "remote", req.RemoteAddr)
+
+			next.ServeHTTP(w, req)
+
+			d := time.Since(start).Round(time.Millisecond)
+
+			log.Info(fmt.Sprintf("⟳ %s %s disconnected after %s", req.Method, req.URL.Path, d),
+				"event", "request", "method", req.Method, "path", req.URL.Path, "remote", req.RemoteAddr, "duration", d.String())
+
+			return
+		}
+
+		// Handlers may rewrite the URL, such as for index files.
+		uri := req.URL.RequestURI()
+		lw := &logWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(lw, req)
+
+		d := time.Since(start)
+
+		log.Info(fmt.Sprintf("⟳ %s %s %d %dB %s", req.Method, uri, lw.status, lw.bytes, d.Round(time.Microsecond)),
+			"event", "request", "method", req.Method, "path", uri, "remote", req.RemoteAddr,
+			"status", lw.status, "bytes", lw.bytes, "duration", d.String())
+	})
+}
+
+// logWriter records the status and size of a response.
+type logWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (lw *logWriter) WriteHeader(code int) {
+	if !lw.wroteHeader {
+		lw.wroteHeader = true
+		lw.status = code
+	}
+
+	lw.ResponseWriter.WriteHeader(code)
+}
+
+func (lw *logWriter) Write(b []byte) (int, error) {
+	lw.wroteHeader = true
+
+	n, err := lw.ResponseWriter.Write(b)
+	lw.bytes += int64(n)
+
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (lw *logWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
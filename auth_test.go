@@ -0,0 +1,63 @@
+package live
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	s := newTestServer(t, map[string]string{"index.html": "<html><body>hello</body></html>"}, "-auth", "user:secret")
+
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for _, target := range []string{"/", "/index.html", "/__livereload", "/__livereload/ws", "/__live/health"} {
+		for _, tt := range []struct {
+			name       string
+			user, pass string
+			want       int
+		}{
+			{"no credentials", "", "", http.StatusUnauthorized},
+			{"bad password", "user", "wrong", http.StatusUnauthorized},
+			{"bad user", "other", "secret", http.StatusUnauthorized},
+			{"credentials", "user", "secret", 0},
+		} {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			req.Header.Set("Sec-WebSocket-Version", "13")
+
+			res, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			want := tt.want
+			if want == 0 {
+				want = http.StatusOK
+				if target == "/__livereload/ws" {
+					want = http.StatusSwitchingProtocols
+				}
+			}
+
+			if res.StatusCode != want {
+				t.Errorf("%s with %s: status %d, want %d", target, tt.name, res.StatusCode, want)
+			}
+
+			if want == http.StatusUnauthorized && res.Header.Get("WWW-Authenticate") == "" {
+				t.Errorf("%s with %s: no WWW-Authenticate header", target, tt.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,17 @@
+// Command live serves a directory over HTTP, reloading the pages open in
+// browsers whenever the files in it change.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/peterhellberg/live"
+)
+
+func main() {
+	if err := live.Run(os.Args); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,218 @@
+package live
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// compress wraps next, compressing text responses for clients accepting it.
+// Range requests are passed through as is, since ranges apply to the
+// uncompressed representation.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		varyAcceptEncoding(w.Header())
+
+		encoding := acceptedEncoding(req.Header.Get("Accept-Encoding"))
+
+		if encoding == "" || req.Method == http.MethodHead || req.Header.Get("Range") != "" {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, req)
+	})
+}
+
+func varyAcceptEncoding(h http.Header) {
+	if !headerContains(h, "Vary", "Accept-Encoding") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+}
+
+// acceptedEncoding returns gzip or deflate if accepted, preferring gzip.
+func acceptedEncoding(header string) string {
+	accepted := acceptedEncodings(header)
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+func acceptedEncodings(header string) map[string]bool {
+	accepted := map[string]bool{}
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	return accepted
+}
+
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// serveCompressed serves a precompressed variant of name, such as app.js.br
+// for app.js, if there is one using an encoding accepted by the client.
+func serveCompressed(w http.ResponseWriter, req *http.Request, fsys fs.FS, name string, mimeTypes map[string]string) bool {
+	accepted := acceptedEncodings(req.Header.Get("Accept-Encoding"))
+
+	for _, p := range precompressed {
+		if !accepted[p.encoding] {
+			continue
+		}
+
+		f, err := fsys.Open(name + p.ext)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		content, ok := f.(io.ReadSeeker)
+		if !ok {
+			continue
+		}
+
+		ctype, ok := mimeTypes[strings.ToLower(filepath.Ext(name))]
+		if !ok {
+			ctype = mime.TypeByExtension(filepath.Ext(name))
+		}
+
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Encoding", p.encoding)
+		varyAcceptEncoding(w.Header())
+
+		http.ServeContent(w, req, name, info.ModTime(), content)
+
+		return true
+	}
+
+	return false
+}
+
+// precompressedWasm sets the headers of a precompressed WebAssembly file that
+// is requested as is, such as app.wasm.br, for it to be compiled while
+// streaming. Clients not accepting the encoding get the file as is.
+func precompressedWasm(h http.Header, req *http.Request, name string, mimeTypes map[string]string) {
+	for _, p := range precompressed {
+		base, ok := strings.CutSuffix(name, p.ext)
+		if !ok || !strings.EqualFold(filepath.Ext(base), ".wasm") {
+			continue
+		}
+
+		if acceptedEncodings(req.Header.Get("Accept-Encoding"))[p.encoding] {
+			h.Set("Content-Type", mimeTypes[".wasm"])
+			h.Set("Content-Encoding", p.encoding)
+			varyAcceptEncoding(h)
+		}
+
+		return
+	}
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+
+	for _, s := range []string{"javascript", "json", "svg", "wasm", "xml"} {
+		if strings.Contains(mediaType, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	w           io.WriteCloser
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	cw.wroteHeader = true
+
+	h := cw.Header()
+
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+
+		switch cw.encoding {
+		case "gzip":
+			cw.w = gzip.NewWriter(cw.ResponseWriter)
+		case "deflate":
+			cw.w = zlib.NewWriter(cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.w != nil {
+		return cw.w.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressWriter) Close() error {
+	if cw.w != nil {
+		return cw.w.Close()
+	}
+
+	return nil
+}
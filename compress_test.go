@@ -0,0 +1,152 @@
+package live
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGzip(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"index.html": "<html><head></head><body>" + strings.Repeat("hello ", 100) + "</body></html>",
+		"style.css":  strings.Repeat("body{}", 100),
+		"image.png":  "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 100),
+		"app.js.gz":  "\x1f\x8b\b\x00",
+	}, "-gzip")
+
+	for _, tt := range []struct {
+		target  string
+		headers []string
+		want    string // Content-Encoding
+	}{
+		{"/", []string{"Accept-Encoding", "gzip, deflate"}, "gzip"},
+		{"/style.css", []string{"Accept-Encoding", "deflate, gzip;q=0.5"}, "gzip"},
+		{"/style.css", []string{"Accept-Encoding", "deflate"}, "deflate"},
+		{"/style.css", []string{"Accept-Encoding", "gzip;q=0"}, ""},
+		{"/style.css", []string{"Accept-Encoding", "gzip", "Range", "bytes=0-9"}, ""},
+		{"/style.css", nil, ""},
+		{"/image.png", []string{"Accept-Encoding", "gzip"}, ""},
+		{"/app.js.gz", []string{"Accept-Encoding", "gzip"}, ""},
+	} {
+		rec := get(s, tt.target, tt.headers...)
+
+		if got := rec.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("GET %s with %q: Content-Encoding %q, want %q", tt.target, tt.headers, got, tt.want)
+		}
+
+		if got := rec.Header().Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+			t.Errorf("GET %s with %q: Vary %q, want Accept-Encoding", tt.target, tt.headers, got)
+		}
+	}
+
+	rec := get(s, "/", "Accept-Encoding", "gzip")
+
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(body), "<script") || !strings.Contains(string(body), "hello") {
+		t.Errorf("decompressed page %q, want it injected", body)
+	}
+}
+
+func TestPrecompressed(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"app.js":        "plain",
+		"app.js.br":     "brotli",
+		"app.js.gz":     "gzip",
+		"style.css":     "plain",
+		"style.css.gz":  "gzip",
+		"other.js":      "plain",
+		"index.html":    "<html><head></head><body>plain</body></html>",
+		"index.html.gz": "gzip",
+	})
+
+	for _, tt := range []struct {
+		target   string
+		accept   string
+		body     string
+		encoding string
+		ctype    string
+	}{
+		{"/app.js", "gzip, deflate, br", "brotli", "br", "text/javascript; charset=utf-8"},
+		{"/app.js", "gzip", "gzip", "gzip", "text/javascript; charset=utf-8"},
+		{"/app.js", "br;q=0, gzip", "gzip", "gzip", "text/javascript; charset=utf-8"},
+		{"/app.js", "", "plain", "", "text/javascript; charset=utf-8"},
+		{"/style.css", "br", "plain", "", "text/css; charset=utf-8"},
+		{"/style.css", "br, gzip", "gzip", "gzip", "text/css; charset=utf-8"},
+		{"/other.js", "br, gzip", "plain", "", "text/javascript; charset=utf-8"},
+		{"/index.html", "gzip", "plain", "", "text/html"},
+	} {
+		rec := get(s, tt.target, "Accept-Encoding", tt.accept)
+
+		if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("GET %s with %q: Content-Encoding %q, want %q", tt.target, tt.accept, got, tt.encoding)
+		}
+
+		if got := rec.Header().Get("Content-Type"); got != tt.ctype {
+			t.Errorf("GET %s with %q: Content-Type %q, want %q", tt.target, tt.accept, got, tt.ctype)
+		}
+
+		if !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("GET %s with %q: body %q, want %q", tt.target, tt.accept, rec.Body, tt.body)
+		}
+	}
+}
+
+func TestPrecompressedWasm(t *testing.T) {
+	for _, args := range [][]string{nil, {"-gzip"}} {
+		s := newTestServer(t, map[string]string{
+			"app.wasm.br":  "brotli",
+			"main.wasm.gz": "gzip",
+		}, args...)
+
+		for _, tt := range []struct {
+			target   string
+			accept   string
+			encoding string
+			ctype    string
+		}{
+			{"/app.wasm", "gzip, br", "br", "application/wasm"},
+			{"/app.wasm.br", "gzip, br", "br", "application/wasm"},
+			{"/main.wasm", "gzip, br", "gzip", "application/wasm"},
+			{"/main.wasm.gz", "gzip", "gzip", "application/wasm"},
+		} {
+			rec := get(s, tt.target, "Accept-Encoding", tt.accept)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("%q: GET %s = %d, want 200", args, tt.target, rec.Code)
+
+				continue
+			}
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("%q: GET %s with %q: Content-Encoding %q, want %q", args, tt.target, tt.accept, got, tt.encoding)
+			}
+
+			if got := rec.Header().Get("Content-Type"); got != tt.ctype {
+				t.Errorf("%q: GET %s with %q: Content-Type %q, want %q", args, tt.target, tt.accept, got, tt.ctype)
+			}
+
+			if body := rec.Body.String(); body != "brotli" && body != "gzip" {
+				t.Errorf("%q: GET %s with %q: body %q, want the file as is", args, tt.target, tt.accept, body)
+			}
+		}
+	}
+
+	// Clients not accepting the encoding get the file as is.
+	s := newTestServer(t, map[string]string{"app.wasm.br": "brotli"})
+	rec := get(s, "/app.wasm.br", "Accept-Encoding", "gzip")
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" || rec.Header().Get("Content-Type") == "application/wasm" {
+		t.Errorf("GET /app.wasm.br without br: Content-Encoding %q and Content-Type %q", got, rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,249 @@
+package live
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configFile is read from the root when no -config is given.
+const configFile = "live.json"
+
+// oneShotOptions can only be given on the command line, since they make live
+// do something else than serving.
+var oneShotOptions = map[string]bool{
+	"config":  true,
+	"version": true,
+	"list":    true,
+}
+
+// loadConfig sets the flags to the values of the JSON object in the file at
+// path, keyed by flag name, except for the flags in set, which were given on
+// the command line. Arrays give repeatable flags, like header, more than one
+// value, and are joined by commas for the others. The values applied are
+// returned.
+func loadConfig(flags *flag.FlagSet, path string, set map[string]bool) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]any
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	applied := map[string]any{}
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if oneShotOptions[name] {
+			return nil, fmt.Errorf("option %q in %s can only be given on the command line", name, path)
+		}
+
+		f := flags.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown option %q in %s", name, path)
+		}
+
+		if set[name] {
+			continue
+		}
+
+		vals, err := configValues(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %w", name, path, err)
+		}
+
+		if _, ok := f.Value.(*listFlag); !ok {
+			vals = []string{strings.Join(vals, ",")}
+		}
+
+		for _, v := range vals {
+			if err := flags.Set(name, v); err != nil {
+				return nil, fmt.Errorf("invalid %s in %s: %w", name, path, err)
+			}
+		}
+
+		applied[name] = values[name]
+	}
+
+	return applied, nil
+}
+
+// configValues returns the flag values of a JSON value.
+func configValues(v any) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case []any:
+		var vals []string
+
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected an array of strings")
+			}
+
+			vals = append(vals, s)
+		}
+
+		return vals, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value %v", v)
+}
+
+// hotOptions are the options applied when the config file changes, while the
+// others require a restart.
+var hotOptions = map[string]bool{
+	"wait":   true,
+	"ignore": true,
+	"header": true,
+}
+
+// hotConfig holds the Config and ignorer in use, replaced when the config
+// file changes. Changes to the ignored paths are signalled on rewatch, for
+// the watches to be updated.
+type hotConfig struct {
+	mu      sync.RWMutex
+	cfg     Config
+	ignored *ignorer
+	rewatch chan struct{}
+}
+
+func (h *hotConfig) get() (Config, *ignorer) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.cfg, h.ignored
+}
+
+func (h *hotConfig) set(cfg Config, ignored *ignorer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.cfg, h.ignored = cfg, ignored
+}
+
+// watchConfig applies the config file again whenever it changes, until ctx
+// is done. Its directory is watched, since editors may replace the file.
+func (s *Server) watchConfig(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(filepath.Dir(s.cfg.config)); err != nil {
+		watcher.Close()
+
+		return err
+	}
+
+	name := filepath.Clean(s.cfg.config)
+
+	go func() {
+		defer watcher.Close()
+
+		var timer *time.Timer
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-watcher.Events:
+				if filepath.Clean(ev.Name) != name || ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+
+				// A save may show up as several events.
+				if timer != nil {
+					timer.Stop()
+				}
+
+				timer = time.AfterFunc(100*time.Millisecond, s.reloadConfig)
+			case err := <-watcher.Errors:
+				s.log.Error("watch error", "event", "watch", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reloadConfig parses the command line and config file again, applying the
+// hotOptions and logging the other options that changed.
+func (s *Server) reloadConfig() {
+	cfg, err := parse(s.cfg.args, flag.ContinueOnError)
+	if err == nil && cfg.config != s.cfg.config {
+		err = fmt.Errorf("%s is no longer used", s.cfg.config)
+	}
+
+	var ignored *ignorer
+
+	if err == nil {
+		ignored, err = newIgnorer(cfg)
+	}
+
+	if err != nil {
+		s.log.Error("⟳ config not applied", "event", "config", "path", s.cfg.config, "error", err)
+
+		return
+	}
+
+	current, _ := s.hot.get()
+
+	names := slices.Sorted(maps.Keys(cfg.configValues))
+
+	for name := range current.configValues {
+		if _, ok := cfg.configValues[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		if hotOptions[name] || reflect.DeepEqual(current.configValues[name], cfg.configValues[name]) {
+			continue
+		}
+
+		s.log.Warn(fmt.Sprintf("⟳ restart to apply the changed %s option", name), "event", "config", "option", name)
+	}
+
+	// Only the hot options are taken from the new Config.
+	next := current
+	next.configValues = cfg.configValues
+	next.waitSpec, next.waits, next.wait = cfg.waitSpec, cfg.waits, cfg.wait
+	next.ignore = cfg.ignore
+	next.header, next.headers = cfg.header, cfg.headers
+
+	s.hot.set(next, ignored)
+
+	if next.ignore != current.ignore {
+		select {
+		case s.hot.rewatch <- struct{}{}:
+		default:
+		}
+	}
+
+	s.log.Info(fmt.Sprintf("⟳ applied %s", s.cfg.config), "event", "config", "path", s.cfg.config)
+}
@@ -0,0 +1,32 @@
+package live
+
+import "net/http"
+
+// cors wraps next, allowing cross-origin requests from origin and answering
+// preflight requests directly.
+func cors(next http.Handler, origin string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h := w.Header()
+
+		h.Set("Access-Control-Allow-Origin", origin)
+
+		if origin != "*" {
+			h.Add("Vary", "Origin")
+		}
+
+		if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, OPTIONS")
+
+			if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+
+			h.Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,121 @@
+package live
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// allowSnippet adds a fresh nonce to the script tags of snippet, and to the
+// script sources of the Content-Security-Policy in h, if the policy would
+// otherwise block the inline reload script. It reports if a nonce was added.
+func allowSnippet(h http.Header, snippet []byte) ([]byte, bool) {
+	policy := h.Get("Content-Security-Policy")
+	if policy == "" {
+		return snippet, false
+	}
+
+	nonce := newNonce()
+
+	policy, ok := addNonce(policy, nonce)
+	if !ok {
+		return snippet, false
+	}
+
+	h.Set("Content-Security-Policy", policy)
+
+	return bytes.ReplaceAll(snippet, []byte("<script"), []byte(`<script nonce="`+nonce+`"`)), true
+}
+
+func newNonce() string {
+	var b [16]byte
+
+	rand.Read(b[:])
+
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+// setPageCacheControl makes browsers always revalidate pages, since they carry
+// the reload script. Those with a nonce are not cached at all, as it is only
+// valid for the response it was sent with.
+func setPageCacheControl(h http.Header, nonce bool) {
+	if nonce {
+		h.Set("Cache-Control", "no-store")
+
+		return
+	}
+
+	h.Set("Cache-Control", "no-cache")
+}
+
+// addNonce allows scripts with nonce in the script-src and script-src-elem
+// directives of policy, or in a script-src copied from default-src if there
+// are none. Directives allowing inline scripts without a nonce or hash are
+// left alone, since adding one would make browsers ignore 'unsafe-inline'.
+func addNonce(policy, nonce string) (string, bool) {
+	var (
+		directives = strings.Split(policy, ";")
+		fallback   = -1
+		found      bool
+		added      bool
+	)
+
+	for i, directive := range directives {
+		sources := strings.Fields(directive)
+		if len(sources) == 0 {
+			continue
+		}
+
+		switch strings.ToLower(sources[0]) {
+		case "default-src":
+			fallback = i
+		case "script-src", "script-src-elem":
+			found = true
+
+			if blocksInline(sources[1:]) {
+				directives[i] = strings.Join(append(sources, "'nonce-"+nonce+"'"), " ")
+				added = true
+			}
+		}
+	}
+
+	if !found && fallback >= 0 {
+		sources := strings.Fields(directives[fallback])[1:]
+
+		if blocksInline(sources) {
+			directives = append(directives, strings.Join(append([]string{"script-src"}, sources...), " ")+" 'nonce-"+nonce+"'")
+			added = true
+		}
+	}
+
+	if !added {
+		return policy, false
+	}
+
+	for i := range directives {
+		directives[i] = strings.TrimSpace(directives[i])
+	}
+
+	directives = slices.DeleteFunc(directives, func(d string) bool { return d == "" })
+
+	return strings.Join(directives, "; "), true
+}
+
+// blocksInline reports if sources do not allow inline scripts as such.
+func blocksInline(sources []string) bool {
+	unsafeInline := false
+
+	for _, source := range sources {
+		switch s := strings.ToLower(source); {
+		case s == "'unsafe-inline'":
+			unsafeInline = true
+		case strings.HasPrefix(s, "'nonce-"), strings.HasPrefix(s, "'sha"):
+			return true
+		}
+	}
+
+	return !unsafeInline
+}
@@ -0,0 +1,66 @@
+package live
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAddNonce(t *testing.T) {
+	for _, tt := range []struct {
+		policy string
+		want   string
+		ok     bool
+	}{
+		{"script-src 'self'", "script-src 'self' 'nonce-n'", true},
+		{"default-src 'self'; img-src *", "default-src 'self'; img-src *; script-src 'self' 'nonce-n'", true},
+		{"script-src 'self'; script-src-elem 'self'", "script-src 'self' 'nonce-n'; script-src-elem 'self' 'nonce-n'", true},
+		{"script-src 'self' 'unsafe-inline'", "script-src 'self' 'unsafe-inline'", false},
+		{"script-src 'unsafe-inline' 'sha256-x'", "script-src 'unsafe-inline' 'sha256-x' 'nonce-n'", true},
+		{"img-src *", "img-src *", false},
+	} {
+		got, ok := addNonce(tt.policy, "n")
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("addNonce(%q) = %q, %v, want %q, %v", tt.policy, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNonceMatchesPolicy(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"index.html":   "<html><head></head><body></body></html>",
+		"404.html":     "<html><head></head><body>missing</body></html>",
+		"dir/file.txt": "text",
+	}, "-header", "Content-Security-Policy: script-src 'self'", "-listing", "-github-pages")
+
+	policyNonce := regexp.MustCompile(`'nonce-([^']+)'`)
+	scriptNonce := regexp.MustCompile(`<script nonce="([^"]+)"`)
+
+	for _, target := range []string{"/", "/dir/", "/missing"} {
+		rec := get(s, target)
+
+		p := policyNonce.FindStringSubmatch(rec.Header().Get("Content-Security-Policy"))
+		if p == nil {
+			t.Errorf("%s: no nonce in policy %q", target, rec.Header().Get("Content-Security-Policy"))
+
+			continue
+		}
+
+		m := scriptNonce.FindAllStringSubmatch(rec.Body.String(), -1)
+		if len(m) != 1 || m[0][1] != p[1] {
+			t.Errorf("%s: script nonces %q, want one of %q", target, m, p[1])
+		}
+
+		if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("%s: Cache-Control = %q, want no-store", target, got)
+		}
+	}
+
+	// Every response gets a nonce of its own.
+	a := get(s, "/").Header().Get("Content-Security-Policy")
+	b := get(s, "/").Header().Get("Content-Security-Policy")
+
+	if a == b || !strings.Contains(a, "'nonce-") {
+		t.Errorf("policies %q and %q, want different nonces", a, b)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package live
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killGroup makes canceling cmd terminate its whole process group, so that
+// the processes it started, such as a bundler, are stopped along with it.
+func killGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = 2 * time.Second
+}
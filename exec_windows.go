@@ -0,0 +1,16 @@
+package live
+
+import (
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// killGroup makes canceling cmd terminate its whole process tree, so that
+// the processes it started, such as a bundler, are stopped along with it.
+func killGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	}
+	cmd.WaitDelay = 2 * time.Second
+}
@@ -0,0 +1,250 @@
+package live
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ignoreFile holds gitignore-style patterns, read from the served root.
+// When present it is used instead of the -ignore flag.
+const ignoreFile = ".liveignore"
+
+// editorFiles are the swap, backup and temporary files written by editors
+// such as Vim, Emacs and JetBrains IDEs, ignored unless -no-default-ignore.
+var editorFiles = []string{
+	"*.swp", "*.swo", "*.swx", "*~", "4913",
+	"#*#", ".#*",
+	"*___jb_tmp___", "*___jb_old___",
+}
+
+type ignoreRule struct {
+	source   string // the line in the ignoreFile
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+type ignorer struct {
+	roots    []string
+	patterns []string
+	rules    []ignoreRule
+	names    []string // matched against the base name only
+	config   string   // the absolute path of the config file, if any
+}
+
+func newIgnorer(cfg Config) (*ignorer, error) {
+	ig := &ignorer{roots: cfg.roots}
+
+	// Changes to the config file are applied instead of reloading pages.
+	if cfg.config != "" {
+		ig.config = absolute(cfg.config)
+	}
+
+	if !cfg.noDefaultIgnore {
+		ig.names = editorFiles
+	}
+
+	data, err := os.ReadFile(filepath.Join(cfg.root, ignoreFile))
+
+	switch {
+	case err == nil:
+		ig.rules = parseIgnoreRules(string(data))
+	case os.IsNotExist(err):
+		ig.patterns = strings.Split(cfg.ignore, ",")
+	default:
+		return nil, err
+	}
+
+	return ig, nil
+}
+
+func parseIgnoreRules(data string) []ignoreRule {
+	var rules []ignoreRule
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r ")
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{source: line}
+
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		if line == "" {
+			continue
+		}
+
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+func isIgnored(path string, ignored *ignorer) bool {
+	_, ok := ignoredBy(path, ignored)
+
+	return ok
+}
+
+// ignoredBy returns the pattern, or the line of the ignoreFile, that path
+// is ignored by.
+func ignoredBy(path string, ignored *ignorer) (string, bool) {
+	base := filepath.Base(path)
+
+	if ignored.config != "" && base == filepath.Base(ignored.config) && absolute(path) == ignored.config {
+		return "-config", true
+	}
+
+	for _, name := range ignored.names {
+		if ok, _ := filepath.Match(name, base); ok {
+			return name, true
+		}
+	}
+
+	rel, ok := relativePath(ignored.roots, path)
+
+	// The roots are watched whatever their names.
+	if !ok && slices.ContainsFunc(ignored.roots, func(root string) bool {
+		return filepath.Clean(root) == filepath.Clean(path)
+	}) {
+		return "", false
+	}
+
+	for _, pattern := range ignored.patterns {
+		if matchPattern(pattern, path, rel) {
+			return pattern, true
+		}
+	}
+
+	if len(ignored.rules) == 0 || !ok {
+		return "", false
+	}
+
+	info, err := os.Lstat(path)
+	isDir := err == nil && info.IsDir()
+
+	// A path is ignored if it, or any of its parent directories, is ignored.
+	segments := strings.Split(rel, "/")
+
+	for i := range segments {
+		if rule, ok := ignored.matchRules(segments[:i+1], i < len(segments)-1 || isDir); ok {
+			return rule.source, true
+		}
+	}
+
+	return "", false
+}
+
+// matchPattern matches an -ignore glob against the full path, the path
+// relative to its root, and each of the segments of that. Without any glob
+// metacharacters this means that a segment has to be equal to the pattern.
+// Patterns like *.map and .map also match the extension of the path. Only
+// paths outside of the roots, where rel is empty, have all their segments
+// matched.
+func matchPattern(pattern, path, rel string) bool {
+	if pattern == "" {
+		return false
+	}
+
+	if ext := strings.TrimPrefix(pattern, "*"); isExtension(ext) && strings.EqualFold(filepath.Ext(path), ext) {
+		return true
+	}
+
+	segments := strings.Split(filepath.ToSlash(path), "/")
+
+	if rel != "" {
+		segments = strings.Split(rel, "/")
+	}
+
+	for _, name := range append([]string{path, rel}, segments...) {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isExtension reports if s is a dot followed by a name without any glob
+// metacharacters, separators or further dots.
+func isExtension(s string) bool {
+	return len(s) > 1 && s[0] == '.' && !strings.ContainsAny(s[1:], `./\*?[`)
+}
+
+// matchRules returns the last of the rules matching segments, reporting if
+// it is not a negation.
+func (ig *ignorer) matchRules(segments []string, isDir bool) (ignoreRule, bool) {
+	var last ignoreRule
+
+	ignored := false
+
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		if rule.matches(segments) {
+			last, ignored = rule, !rule.negate
+		}
+	}
+
+	return last, ignored
+}
+
+func (rule ignoreRule) matches(segments []string) bool {
+	if rule.anchored {
+		return matchSegments(strings.Split(rule.pattern, "/"), segments)
+	}
+
+	ok, _ := path.Match(rule.pattern, segments[len(segments)-1])
+
+	return ok
+}
+
+// matchSegments matches path segments against glob segments, where ** matches
+// zero or more segments.
+func matchSegments(globs, segments []string) bool {
+	for len(globs) > 0 {
+		if globs[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(globs[1:], segments[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(globs[0], segments[0]); !ok {
+			return false
+		}
+
+		globs, segments = globs[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
@@ -0,0 +1,209 @@
+package live
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// newTestIgnorer returns the ignorer for a root inside a build directory,
+// holding files, configured by args.
+func newTestIgnorer(t *testing.T, files map[string]string, args ...string) (*ignorer, string) {
+	t.Helper()
+
+	root := filepath.Join(writeFiles(t, prefixed("build/site/", files)), "build", "site")
+
+	cfg, err := Parse(append([]string{"live", "-root", root}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ig, err := newIgnorer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ig, root
+}
+
+func prefixed(prefix string, files map[string]string) map[string]string {
+	m := map[string]string{prefix + ".keep": ""}
+
+	for name, data := range files {
+		m[prefix+name] = data
+	}
+
+	return m
+}
+
+func TestIgnoreFile(t *testing.T) {
+	files := map[string]string{
+		".liveignore": "# generated\n" +
+			"*.log\n" +
+			"!keep.log\n" +
+			"tmp/\n" +
+			"/dist\n" +
+			"docs/**/*.draft.md\n",
+		"index.html":          "",
+		"build.log":           "",
+		"keep.log":            "",
+		"tmp/a.html":          "",
+		"src/tmp/b.html":      "",
+		"tmp.html":            "",
+		"dist/app.js":         "",
+		"src/dist/app.js":     "",
+		"docs/a.draft.md":     "",
+		"docs/x/y/b.draft.md": "",
+		"docs/c.md":           "",
+		"node_modules/x.js":   "",
+	}
+
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{"index.html", false},
+		{"build.log", true},
+		{"keep.log", false},
+		{"tmp", true},
+		{"tmp/a.html", true},
+		{"src/tmp/b.html", true},
+		{"tmp.html", false},
+		{"dist/app.js", true},
+		{"src/dist/app.js", false},
+		{"docs/a.draft.md", true},
+		{"docs/x/y/b.draft.md", true},
+		{"docs/c.md", false},
+		// The -ignore flag is not used with a .liveignore.
+		{"node_modules/x.js", false},
+	} {
+		ig, root := newTestIgnorer(t, files)
+
+		if got := isIgnored(filepath.Join(root, filepath.FromSlash(tt.path)), ig); got != tt.want {
+			t.Errorf("isIgnored(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreRoot(t *testing.T) {
+	ig, root := newTestIgnorer(t, nil, "-ignore", "site,build")
+
+	if isIgnored(root, ig) {
+		t.Errorf("isIgnored(%q) = true, want the root to be watched", root)
+	}
+
+	if !isIgnored(filepath.Join(filepath.Dir(root), "other", "site"), ig) {
+		t.Errorf("paths outside of the root should match all their segments")
+	}
+}
+
+func TestParseIgnoreRules(t *testing.T) {
+	got := parseIgnoreRules("# comment\n\n!/a/b/\r\nc\n/\n")
+
+	want := []ignoreRule{
+		{source: "!/a/b/", pattern: "a/b", negate: true, dirOnly: true, anchored: true},
+		{source: "c", pattern: "c"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("parseIgnoreRules = %+v, want %+v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestIgnorePatterns(t *testing.T) {
+	files := map[string]string{
+		"index.html":        "",
+		"app.js.map":        "",
+		"dist/app.js":       "",
+		"src/build/app.js":  "",
+		"node_modules/x.js": "",
+		"notes.swp":         "",
+	}
+
+	for _, tt := range []struct {
+		ignore string
+		path   string
+		want   bool
+	}{
+		{".git,node_modules", "index.html", false},
+		{".git,node_modules", "node_modules/x.js", true},
+		{".git,node_modules", "node_modules", true},
+		{"dist", "dist/app.js", true},
+		{"dist", "src/build/app.js", false},
+		{"dis", "dist/app.js", false},
+		{".map", "app.js.map", true},
+		{"*.map", "app.js.map", true},
+		{"*.MAP", "app.js.map", true},
+		{".map", "index.html", false},
+		{"*.js", "dist/app.js", true},
+		{"*.js", "index.html", false},
+		{"src/*", "src/build", true},
+		{"build", "src/build/app.js", true},
+		{"dist,.map", "app.js.map", true},
+		{"dist,.map", "dist/app.js", true},
+		{"dist,.map", "index.html", false},
+		{"", "notes.swp", true},
+		// The directories above the root are not matched.
+		{"build", "index.html", false},
+		{"site", "dist/app.js", false},
+		{"tmp*", "index.html", false},
+	} {
+		ig, root := newTestIgnorer(t, files, "-ignore", tt.ignore)
+
+		if got := isIgnored(filepath.Join(root, filepath.FromSlash(tt.path)), ig); got != tt.want {
+			t.Errorf("-ignore %q: isIgnored(%q) = %v, want %v", tt.ignore, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreExtensions(t *testing.T) {
+	files := map[string]string{
+		"app.js":         "",
+		"app.js.map":     "",
+		"debug.LOG":      "",
+		"logs/today.txt": "",
+		"map/index.html": "",
+		"x.map/a.js":     "",
+		"dist/app.js":    "",
+	}
+
+	ig, root := newTestIgnorer(t, files, "-ignore", "dist,*.log,.map,logs")
+
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{"app.js", false},
+		{"app.js.map", true},
+		{"debug.LOG", true},
+		{"logs/today.txt", true},
+		{"map/index.html", false},
+		{"x.map/a.js", false},
+		{"dist/app.js", true},
+	} {
+		if got := isIgnored(filepath.Join(root, filepath.FromSlash(tt.path)), ig); got != tt.want {
+			t.Errorf("isIgnored(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		s    string
+		want bool
+	}{
+		{".map", true},
+		{".", false},
+		{"map", false},
+		{".min.js", false},
+		{".m?p", false},
+		{"./x", false},
+	} {
+		if got := isExtension(tt.s); got != tt.want {
+			t.Errorf("isExtension(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package live
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>{{.Path}}</title>
+<style>
+body{font:14px/1.5 system-ui,sans-serif;margin:2em;color:#222}
+h1{font-size:1.2em;font-weight:normal}
+table{border-collapse:collapse}
+td{padding:.2em 1.5em .2em 0;white-space:nowrap}
+td.size{text-align:right;color:#777}
+td.time{color:#777}
+a{color:#0366d6;text-decoration:none}
+a:hover{text-decoration:underline}
+</style>
+</head>
+<body>
+<h1>{{.Path}}</h1>
+<table>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}</a></td><td class="size">{{.Size}}</td><td class="time">{{.Time}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type listingEntry struct {
+	Name string
+	Href string
+	Size string
+	Time string
+	dir  bool
+}
+
+// serveListing writes an HTML listing of dir, with directories first.
+func serveListing(w http.ResponseWriter, req *http.Request, fsys fs.FS, dir string, cfg Config) {
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		http.Error(w, "error reading directory", http.StatusInternalServerError)
+
+		return
+	}
+
+	entries := make([]listingEntry, 0, len(files))
+
+	for _, file := range files {
+		if cfg.noDotfiles && isDotfile(file.Name()) {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		entry := listingEntry{
+			Name: file.Name(),
+			Href: (&url.URL{Path: "./" + file.Name()}).String(),
+			Time: info.ModTime().Format(time.DateTime),
+			dir:  info.IsDir(),
+		}
+
+		if entry.dir {
+			entry.Name += "/"
+			entry.Href += "/"
+		} else {
+			entry.Size = formatSize(info.Size())
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].dir != entries[j].dir {
+			return entries[i].dir
+		}
+
+		return entries[i].Name < entries[j].Name
+	})
+
+	var buf bytes.Buffer
+
+	if err := listingTemplate.Execute(&buf, struct {
+		Path    string
+		Entries []listingEntry
+	}{cfg.base + req.URL.Path, entries}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	data := buf.Bytes()
+
+	nonce := false
+
+	if !cfg.noInject {
+		var snippet []byte
+
+		snippet, nonce = allowSnippet(w.Header(), cfg.snippet)
+		data = injectReload(data, snippet, cfg.inject)
+	}
+
+	setPageCacheControl(w.Header(), nonce)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
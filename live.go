@@ -0,0 +1,2867 @@
+// Package live serves a directory over HTTP, reloading the pages open in
+// browsers whenever the files in it change. The live command is a thin wrapper
+// around Run, and New returns a Server for use in other programs.
+package live
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type Config struct {
+	root            string
+	roots           []string
+	addr            string
+	host            string
+	wait            time.Duration
+	ignore          string
+	open            bool
+	tls             bool
+	cert            string
+	key             string
+	spa             bool
+	exec            listFlag
+	poll            time.Duration
+	qr              bool
+	gzip            bool
+	index           string
+	indexes         []string
+	quiet           bool
+	verbose         bool
+	log             string
+	heartbeat       time.Duration
+	retry           time.Duration
+	wasmExec        bool
+	mime            string
+	mimeTypes       map[string]string
+	reloadPath      string
+	wasmBust        bool
+	inject          string
+	noInject        bool
+	snippetFile     string
+	snippet         []byte
+	proxy           listFlag
+	proxies         map[string]*url.URL
+	cors            bool
+	corsOrigin      string
+	auth            string
+	cacheControl    string
+	cleanURLs       bool
+	base            string
+	listing         bool
+	watchPaths      []string
+	maxWait         time.Duration
+	waitSpec        string
+	waits           map[string]time.Duration
+	followSymlinks  bool
+	openPath        string
+	browser         string
+	port            string
+	autoPort        bool
+	version         bool
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	markdown        bool
+	templates       bool
+	data            string
+	socket          string
+	noDefaultIgnore bool
+	minInterval     time.Duration
+	maxClients      int
+	accessLog       bool
+	header          listFlag
+	headers         http.Header
+	sync            bool
+	mount           listFlag
+	mounts          map[string]string
+	noDotfiles      bool
+	reuseTab        bool
+	notify          bool
+	watchExt        string
+	watchExts       map[string]bool
+	noServe         bool
+	reload          string
+	maxLifetime     time.Duration
+	watchGroup      string
+	watchGroups     []watchGroup
+	reloadPort      int
+	githubPages     bool
+	config          string
+	args            []string
+	configValues    map[string]any
+	list            bool
+}
+
+// livePath is the URL path of the endpoints controlling live, besides the
+// reload stream and trigger at -reload-path.
+const livePath = "/__live"
+
+// validPath reports if p is an absolute URL path that can be used both as a
+// mux pattern and in the reload script.
+func validPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.ContainsAny(p, "\"'\\<>{} \t\n?#")
+}
+
+// headerName matches the tokens allowed as HTTP header names.
+var headerName = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// groupName matches the names allowed for -watch-group.
+var groupName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var hostname = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+// validHost reports if host is empty, an IP address or a hostname. Hostnames
+// ending in a numeric label are rejected, as those are malformed addresses.
+func validHost(host string) bool {
+	if host == "" {
+		return true
+	}
+
+	if _, err := netip.ParseAddr(host); err == nil {
+		return true
+	}
+
+	labels := strings.Split(host, ".")
+
+	_, err := strconv.Atoi(labels[len(labels)-1])
+
+	return hostname.MatchString(host) && err != nil
+}
+
+// listFlag is a flag that can be given more than once.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+
+	return nil
+}
+
+// Parse returns the Config of the command line args, where args[0] is the
+// name of the program. Like the flag package it exits on -h and invalid flags.
+func Parse(args []string) (Config, error) {
+	return parse(args, flag.ExitOnError)
+}
+
+// Option changes the flags of a Config made by NewConfig.
+type Option func(args *[]string)
+
+// Flag sets the flag name, as given on the command line, to value.
+func Flag(name, value string) Option {
+	return func(args *[]string) {
+		*args = append(*args, "-"+name+"="+value)
+	}
+}
+
+// Root sets the directory to serve.
+func Root(dir string) Option {
+	return Flag("root", dir)
+}
+
+// Addr sets the address to listen on.
+func Addr(addr string) Option {
+	return Flag("addr", addr)
+}
+
+// Wait sets how long to wait for further changes before reloading.
+func Wait(d time.Duration) Option {
+	return Flag("wait", d.String())
+}
+
+// NoBrowser keeps the browser from being opened.
+func NoBrowser() Option {
+	return Flag("open", "false")
+}
+
+// NewConfig returns the Config of the flag defaults, changed by opts.
+func NewConfig(opts ...Option) (Config, error) {
+	args := []string{"live"}
+
+	for _, opt := range opts {
+		opt(&args)
+	}
+
+	return parse(args, flag.ContinueOnError)
+}
+
+func parse(args []string, handling flag.ErrorHandling) (Config, error) {
+	cfg := Config{args: args}
+
+	flags := flag.NewFlagSet(args[0], handling)
+
+	// The errors are returned instead.
+	if handling == flag.ContinueOnError {
+		flags.SetOutput(io.Discard)
+	}
+
+	flags.StringVar(&cfg.config, "config", "", "JSON file of flag values keyed by flag name, overridden by the command line (default live.json in the root, if any)")
+	flags.StringVar(&cfg.root, "root", ".", "directory to serve, followed by extra comma-separated directories to watch")
+	flags.StringVar(&cfg.addr, "addr", "0.0.0.0:9222", "addr to listen on")
+	flags.StringVar(&cfg.port, "port", "", "port to listen on, overriding the port in -addr, 0 for any free port")
+	flags.IntVar(&cfg.reloadPort, "reload-port", 0, "serve the live reload endpoints on this port instead, allowing any origin")
+	flags.BoolVar(&cfg.autoPort, "auto-port", false, "try the following ports if the port is busy, then any free port")
+	flags.StringVar(&cfg.socket, "socket", "", "listen on this Unix domain socket instead of -addr, without opening a browser")
+	flags.StringVar(&cfg.host, "host", "", "host to listen on, overriding the host in -addr (e.g. 127.0.0.1, ::1, or empty for all interfaces)")
+	flags.StringVar(&cfg.waitSpec, "wait", "100ms", "reload wait duration, optionally per extension (e.g. 200ms or .js=300ms,.css=20ms,default=100ms)")
+	flags.DurationVar(&cfg.maxWait, "max-wait", 0, "reload at the latest this long after the first change in a burst, 0 for no limit")
+	flags.StringVar(&cfg.watchGroup, "watch-group", "", `comma-separated list of named globs (e.g. docs=docs/**,app=app/**), reloading only pages with a matching data-live-group on <html>`)
+	flags.StringVar(&cfg.watchExt, "watch-ext", "", "comma-separated list of extensions to reload on (e.g. .html,.css,.js), all files if empty")
+	flags.StringVar(&cfg.ignore, "ignore", ".git,.zig-cache,node_modules", "comma-separated list of path segments, extensions (e.g. .map) or globs to ignore, unless there is a .liveignore in the root")
+	flags.BoolVar(&cfg.followSymlinks, "follow-symlinks", false, "watch and serve symlinked directories, even if they point outside the root")
+	flags.BoolVar(&cfg.noDefaultIgnore, "no-default-ignore", false, "do not ignore editor swap and temporary files")
+	flags.BoolVar(&cfg.open, "open", true, "automatically open browser")
+	flags.BoolVar(&cfg.reuseTab, "reuse-tab", false, "only open the browser if no tab reconnects shortly after starting")
+	flags.StringVar(&cfg.browser, "browser", "", "browser to open instead of $BROWSER or the default, such as chrome, firefox, safari, edge or a path to an executable")
+	flags.StringVar(&cfg.openPath, "open-path", "", "path to open in the browser (e.g. /admin/dashboard)")
+	flags.BoolVar(&cfg.tls, "tls", false, "serve over HTTPS (self-signed certificate unless -cert and -key are given)")
+	flags.StringVar(&cfg.cert, "cert", "", "TLS certificate file (requires -key)")
+	flags.StringVar(&cfg.key, "key", "", "TLS key file (requires -cert)")
+	flags.StringVar(&cfg.base, "base", "", "URL path prefix to serve everything under (e.g. /myapp)")
+	flags.StringVar(&cfg.reloadPath, "reload-path", "/__livereload", "URL path of the reload stream and trigger endpoints")
+	flags.StringVar(&cfg.mime, "mime", "", "comma-separated list of content type overrides (e.g. .md=text/plain)")
+	flags.StringVar(&cfg.inject, "inject", "head", "where to inject the reload script, head or body")
+	flags.BoolVar(&cfg.noInject, "no-inject", false, "serve HTML as is, without the reload script")
+	flags.StringVar(&cfg.snippetFile, "snippet", "", "file with a custom reload script, {{.ReloadPath}} is replaced with -reload-path")
+	flags.BoolVar(&cfg.wasmBust, "wasm-bust", true, "patch fetch in served pages to bypass the cache for .wasm files")
+	flags.BoolVar(&cfg.wasmExec, "wasm-exec", true, "serve wasm_exec.js from GOROOT when it is not found in the root")
+	flags.StringVar(&cfg.auth, "auth", "", "require HTTP Basic Auth with these credentials (user:pass)")
+	flags.BoolVar(&cfg.cors, "cors", false, "allow cross-origin requests")
+	flags.StringVar(&cfg.corsOrigin, "cors-origin", "*", "origin allowed by -cors")
+	flags.Var(&cfg.header, "header", `header to set on every served file (e.g. "X-Frame-Options: DENY"), may be repeated`)
+	flags.BoolVar(&cfg.noDotfiles, "no-dotfiles", false, "respond with 404 Not Found for files and directories starting with a dot")
+	flags.Var(&cfg.mount, "mount", "serve an extra directory under a path prefix (e.g. /assets=../shared/assets), may be repeated")
+	flags.Var(&cfg.proxy, "proxy", "proxy requests under a path prefix to a backend (e.g. /api=http://localhost:3000), may be repeated")
+	flags.BoolVar(&cfg.notify, "notify", false, "show a desktop notification when the -exec command fails")
+	flags.DurationVar(&cfg.maxLifetime, "max-lifetime", 0, "shut down gracefully after running this long (e.g. 10m in CI), 0 for no limit")
+	flags.BoolVar(&cfg.list, "list", false, "print the directories that would be watched and the paths that would be ignored, then exit")
+	flags.BoolVar(&cfg.noServe, "no-serve", false, "only watch and run the -exec commands, without serving or opening the browser")
+	flags.Var(&cfg.exec, "exec", "command to run before reloading, the reload is skipped if it fails, may be repeated to run steps in order")
+	flags.DurationVar(&cfg.poll, "poll", 0, "poll for changes at this interval instead of using filesystem events (e.g. 500ms, 2s)")
+	flags.StringVar(&cfg.index, "index", "index.html", "comma-separated list of index files to look for in directories, in order")
+	flags.StringVar(&cfg.cacheControl, "cache-control", "", "Cache-Control header for files other than HTML, which is always no-cache")
+	flags.BoolVar(&cfg.gzip, "gzip", false, "compress text responses using gzip or deflate")
+	flags.BoolVar(&cfg.quiet, "quiet", false, "only log errors")
+	flags.BoolVar(&cfg.verbose, "verbose", false, "log filesystem events, client connections and reloads")
+	flags.StringVar(&cfg.reload, "reload", "auto", "how pages are updated: auto swaps stylesheets and images, full always reloads, soft never reloads")
+	flags.BoolVar(&cfg.sync, "sync", false, "mirror scrolling and clicks between connected browsers")
+	flags.BoolVar(&cfg.accessLog, "access-log", false, "log every request with its status, size and duration")
+	flags.DurationVar(&cfg.readTimeout, "read-timeout", 30*time.Second, "maximum duration for reading a request, 0 for no limit")
+	flags.DurationVar(&cfg.writeTimeout, "write-timeout", 0, "maximum duration for writing a response, 0 for no limit (the reload stream is exempt)")
+	flags.DurationVar(&cfg.idleTimeout, "idle-timeout", 2*time.Minute, "how long idle keep-alive connections are kept open, 0 for no limit")
+	flags.DurationVar(&cfg.heartbeat, "heartbeat", 15*time.Second, "interval between keepalive comments on the reload stream, 0 to disable")
+	flags.DurationVar(&cfg.minInterval, "min-interval", 0, "minimum duration between reloads, dropping all but the last one in between")
+	flags.IntVar(&cfg.maxClients, "max-clients", 0, "maximum number of connected browsers, 0 for no limit")
+	flags.DurationVar(&cfg.retry, "retry", 500*time.Millisecond, "how long browsers wait before reconnecting to the reload stream, 0 for their default")
+	flags.StringVar(&cfg.log, "log", "text", "log format, text or json")
+	flags.BoolVar(&cfg.qr, "qr", false, "print a QR code of the network URL")
+	flags.BoolVar(&cfg.cleanURLs, "clean-urls", false, "serve about.html at /about, redirecting requests including the .html extension")
+	flags.BoolVar(&cfg.templates, "templates", false, "render .gohtml files as Go HTML templates, with the templates in the root available as partials")
+	flags.StringVar(&cfg.data, "data", "data.json", "JSON file with the data for -templates, relative to the root")
+	flags.BoolVar(&cfg.markdown, "markdown", false, "render .md files as HTML pages with the reload script")
+	flags.BoolVar(&cfg.listing, "listing", false, "render directory listings as styled pages with the reload script")
+	flags.BoolVar(&cfg.version, "version", false, "print the version and exit")
+	flags.BoolVar(&cfg.githubPages, "github-pages", false, "serve 404.html with a 404 Not Found status for missing paths, like GitHub Pages")
+	flags.BoolVar(&cfg.spa, "spa", false, "serve index.html for missing paths that accept HTML (single-page apps)")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [flags] [path ...]\n\nPaths, if given, are watched instead of the roots.\n\n", flags.Name())
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return cfg, err
+	}
+
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	// Flags given on the command line take precedence over the config file.
+	if cfg.config == "" {
+		root, _, _ := strings.Cut(cfg.root, ",")
+
+		name := filepath.Join(root, configFile)
+
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			cfg.config = name
+		}
+	}
+
+	if cfg.config != "" {
+		values, err := loadConfig(flags, cfg.config, set)
+		if err != nil {
+			return cfg, err
+		}
+
+		cfg.configValues = values
+
+		for name := range values {
+			set[name] = true
+		}
+	}
+
+	// The version is printed by run, without validating the other flags.
+	if cfg.version {
+		return cfg, nil
+	}
+
+	cfg.watchPaths = flags.Args()
+
+	for _, root := range strings.Split(cfg.root, ",") {
+		if root != "" {
+			cfg.roots = append(cfg.roots, root)
+		}
+	}
+
+	if cfg.quiet && cfg.verbose {
+		return cfg, fmt.Errorf("-quiet and -verbose are mutually exclusive")
+	}
+
+	if cfg.log != "text" && cfg.log != "json" {
+		return cfg, fmt.Errorf("unknown log format %q", cfg.log)
+	}
+
+	if cfg.auth != "" && !strings.Contains(cfg.auth, ":") {
+		return cfg, fmt.Errorf("invalid -auth %q, expected user:pass", cfg.auth)
+	}
+
+	if cfg.reloadPort < 0 || cfg.reloadPort > 65535 {
+		return cfg, fmt.Errorf("invalid -reload-port %d", cfg.reloadPort)
+	}
+
+	// EventSource does not send credentials to other origins.
+	if cfg.reloadPort > 0 && cfg.auth != "" {
+		return cfg, fmt.Errorf("-reload-port cannot be used with -auth")
+	}
+
+	if cfg.inject != "head" && cfg.inject != "body" {
+		return cfg, fmt.Errorf("unknown inject position %q", cfg.inject)
+	}
+
+	if cfg.reload != "auto" && cfg.reload != "full" && cfg.reload != "soft" {
+		return cfg, fmt.Errorf("unknown reload mode %q", cfg.reload)
+	}
+
+	if len(cfg.roots) == 0 {
+		return cfg, fmt.Errorf("no root directory given")
+	}
+
+	cfg.root = cfg.roots[0]
+
+	if info, err := os.Stat(cfg.root); err != nil {
+		return cfg, fmt.Errorf("root %q does not exist", absolute(cfg.root))
+	} else if !info.IsDir() {
+		return cfg, fmt.Errorf("root %q is not a directory", absolute(cfg.root))
+	}
+
+	cfg.reloadPath = strings.TrimRight(cfg.reloadPath, "/")
+
+	if !validPath(cfg.reloadPath) {
+		return cfg, fmt.Errorf("invalid -reload-path %q", cfg.reloadPath)
+	}
+
+	if cfg.base = strings.TrimRight(cfg.base, "/"); cfg.base != "" && !validPath(cfg.base) {
+		return cfg, fmt.Errorf("invalid -base %q", cfg.base)
+	}
+
+	snippet, err := renderSnippet(cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("-snippet: %w", err)
+	}
+
+	cfg.snippet = snippet
+
+	cfg.waits = map[string]time.Duration{}
+
+	for _, entry := range strings.Split(cfg.waitSpec, ",") {
+		ext, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			ext, value = "default", entry
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid -wait entry %q", entry)
+		}
+
+		if ext == "default" {
+			cfg.wait = d
+
+			continue
+		}
+
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+
+		cfg.waits[strings.ToLower(ext)] = d
+	}
+
+	// Streaming compilation of WebAssembly requires application/wasm,
+	// which not every system mime table maps .wasm to.
+	cfg.mimeTypes = map[string]string{".wasm": "application/wasm"}
+
+	for _, entry := range strings.Split(cfg.mime, ",") {
+		if entry == "" {
+			continue
+		}
+
+		ext, ctype, ok := strings.Cut(entry, "=")
+		if !ok || ext == "" || ctype == "" {
+			return cfg, fmt.Errorf("invalid -mime entry %q, expected ext=type", entry)
+		}
+
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+
+		cfg.mimeTypes[strings.ToLower(ext)] = ctype
+	}
+
+	cfg.proxies = map[string]*url.URL{}
+
+	for _, entry := range cfg.proxy {
+		prefix, target, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return cfg, fmt.Errorf("invalid -proxy entry %q, expected /prefix=url", entry)
+		}
+
+		u, err := url.Parse(target)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return cfg, fmt.Errorf("invalid -proxy target %q", target)
+		}
+
+		prefix = strings.TrimRight(prefix, "/")
+
+		if prefix == "" || prefix == cfg.reloadPath || prefix == livePath {
+			return cfg, fmt.Errorf("invalid -proxy prefix %q", entry)
+		}
+
+		if _, ok := cfg.proxies[prefix]; ok {
+			return cfg, fmt.Errorf("duplicate -proxy prefix %q", prefix)
+		}
+
+		cfg.proxies[prefix] = u
+	}
+
+	cfg.mounts = map[string]string{}
+
+	for _, entry := range cfg.mount {
+		prefix, dir, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") || dir == "" {
+			return cfg, fmt.Errorf("invalid -mount entry %q, expected /prefix=dir", entry)
+		}
+
+		prefix = strings.TrimRight(prefix, "/")
+
+		if prefix == "" || prefix == cfg.reloadPath || prefix == livePath || !validPath(prefix) {
+			return cfg, fmt.Errorf("invalid -mount prefix %q", entry)
+		}
+
+		if _, ok := cfg.mounts[prefix]; ok {
+			return cfg, fmt.Errorf("duplicate -mount prefix %q", prefix)
+		}
+
+		if _, ok := cfg.proxies[prefix]; ok {
+			return cfg, fmt.Errorf("-mount prefix %q is already proxied", prefix)
+		}
+
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return cfg, fmt.Errorf("invalid -mount directory %q", dir)
+		}
+
+		// Mounted directories are watched along with the root.
+		cfg.mounts[prefix] = dir
+		cfg.roots = append(cfg.roots, dir)
+	}
+
+	cfg.headers = http.Header{}
+
+	for _, entry := range cfg.header {
+		name, value, ok := strings.Cut(entry, ":")
+		if name = strings.TrimSpace(name); !ok || !headerName.MatchString(name) {
+			return cfg, fmt.Errorf("invalid -header %q, expected \"Name: Value\"", entry)
+		}
+
+		cfg.headers.Add(name, strings.TrimSpace(value))
+	}
+
+	for _, entry := range strings.Split(cfg.watchGroup, ",") {
+		if entry == "" {
+			continue
+		}
+
+		name, glob, ok := strings.Cut(entry, "=")
+		if !ok || !groupName.MatchString(name) || glob == "" {
+			return cfg, fmt.Errorf("invalid -watch-group entry %q, expected name=glob", entry)
+		}
+
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return cfg, fmt.Errorf("invalid -watch-group glob %q", glob)
+		}
+
+		cfg.watchGroups = append(cfg.watchGroups, watchGroup{name, strings.Trim(glob, "/")})
+	}
+
+	for _, ext := range strings.Split(cfg.watchExt, ",") {
+		if ext = strings.ToLower(strings.TrimSpace(ext)); ext != "" {
+			if cfg.watchExts == nil {
+				cfg.watchExts = map[string]bool{}
+			}
+
+			cfg.watchExts["."+strings.TrimPrefix(ext, ".")] = true
+		}
+	}
+
+	for _, name := range strings.Split(cfg.index, ",") {
+		if name != "" {
+			cfg.indexes = append(cfg.indexes, name)
+		}
+	}
+
+	// An empty -host means all interfaces, which requires telling it apart
+	// from -host not being given at all.
+	if set["host"] {
+		_, port, err := net.SplitHostPort(cfg.addr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid -addr %q: %w", cfg.addr, err)
+		}
+
+		cfg.addr = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(cfg.host, "["), "]"), port)
+	}
+
+	if cfg.port != "" {
+		host, _, err := net.SplitHostPort(cfg.addr)
+		if err != nil {
+			return cfg, err
+		}
+
+		cfg.addr = net.JoinHostPort(host, cfg.port)
+	}
+
+	host, _, err := net.SplitHostPort(cfg.addr)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid -addr %q: %w", cfg.addr, err)
+	}
+
+	if !validHost(host) {
+		return cfg, fmt.Errorf("invalid host %q, expected an IP address or a hostname such as 127.0.0.1, ::1 or localhost", host)
+	}
+
+	return cfg, nil
+}
+
+// Run runs live with the command line args, as the live command does.
+func Run(args []string) error {
+	cfg, err := Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if cfg.version {
+		fmt.Println(version())
+
+		return nil
+	}
+
+	if cfg.list {
+		return listWatched(cfg, os.Stdout)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := New(cfg)
+
+	// Serving these is most likely a mistake, given how much they contain.
+	if root := resolve(cfg.root); root == filepath.VolumeName(root)+string(filepath.Separator) {
+		s.log.Warn(fmt.Sprintf("⟳ serving the filesystem root %q", root), "event", "root", "root", root)
+	} else if home, err := os.UserHomeDir(); err == nil && root == resolve(home) {
+		s.log.Warn(fmt.Sprintf("⟳ serving the home directory %q", root), "event", "root", "root", root)
+	}
+
+	if cfg.maxLifetime > 0 {
+		timer := time.AfterFunc(cfg.maxLifetime, func() {
+			s.log.Info(fmt.Sprintf("⟳ reached the -max-lifetime of %s", cfg.maxLifetime),
+				"event", "lifetime", "duration", cfg.maxLifetime.String())
+
+			stop()
+		})
+		defer timer.Stop()
+	}
+
+	go reloadOnHangup(ctx, s)
+
+	return s.ListenAndServe(ctx)
+}
+
+// reloadOnHangup reloads the connected clients on SIGHUP, as sent by kill -HUP.
+// There is no SIGHUP on Windows, so it never reloads there.
+func reloadOnHangup(ctx context.Context, s *Server) {
+	hup := make(chan os.Signal, 1)
+
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			s.Reload()
+		}
+	}
+}
+
+// Server serves a directory with live reloading of HTML pages.
+type Server struct {
+	cfg      Config
+	log      *slog.Logger
+	mux      *http.ServeMux
+	handler  http.Handler
+	reloader *reloader
+	reloads  http.Handler // the reload endpoints, with -reload-port
+	hot      *hotConfig
+}
+
+// New returns a Server configured by cfg.
+func New(cfg Config) *Server {
+	return NewFS(cfg, os.DirFS(cfg.root))
+}
+
+// NewFS returns a Server configured by cfg, serving the files in fsys, such as
+// an embed.FS, instead of those in the root. The root is still watched.
+func NewFS(cfg Config, fsys fs.FS) *Server {
+	log := newLogger(cfg)
+
+	s := &Server{
+		cfg:      cfg,
+		log:      log,
+		mux:      http.NewServeMux(),
+		reloader: newReloader(cfg, log),
+		hot:      &hotConfig{cfg: cfg, rewatch: make(chan struct{}, 1)},
+	}
+
+	reloads := s.mux
+
+	if cfg.reloadPort > 0 {
+		reloads = http.NewServeMux()
+	}
+
+	reloads.HandleFunc(cfg.reloadPath, s.reloader.endpoint)
+	reloads.HandleFunc(cfg.reloadPath+"/ws", s.reloader.websocket)
+	reloads.HandleFunc("POST "+cfg.reloadPath+"/trigger", s.reloader.trigger)
+	reloads.HandleFunc("POST "+livePath+"/reload", s.reloader.reload)
+	reloads.HandleFunc("GET "+livePath+"/health", s.health)
+	reloads.HandleFunc("GET "+livePath+"/stats", s.reloader.stats)
+
+	if cfg.sync {
+		reloads.HandleFunc("POST "+livePath+"/sync", s.reloader.sync)
+	}
+
+	// On their own port the endpoints are always requested cross-origin.
+	if cfg.reloadPort > 0 {
+		s.reloads = cors(reloads, "*")
+
+		if cfg.accessLog {
+			s.reloads = accessLog(s.reloads, log, cfg.reloadPath, cfg.reloadPath+"/ws")
+		}
+	}
+
+	for prefix, target := range cfg.proxies {
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorLog = slog.NewLogLogger(log.Handler(), slog.LevelError)
+
+		s.mux.Handle(prefix, proxy)
+		s.mux.Handle(prefix+"/", proxy)
+	}
+
+	files := func(cfg Config, fsys fs.FS) http.Handler {
+		var h http.Handler = http.HandlerFunc(newRootFunc(cfg, fsys))
+
+		// Headers may be added by a changed config file.
+		if len(cfg.headers) > 0 || cfg.config != "" {
+			h = setHeaders(h, s.hot)
+		}
+
+		if cfg.gzip {
+			h = compress(h)
+		}
+
+		return h
+	}
+
+	// Mounts take precedence over the root, being more specific patterns.
+	for prefix, dir := range cfg.mounts {
+		mount := cfg
+		mount.root = dir
+		mount.base = cfg.base + prefix
+
+		s.mux.Handle(prefix+"/", http.StripPrefix(prefix, files(mount, os.DirFS(dir))))
+
+		// A relative redirect, instead of the one of the mux, to keep any -base.
+		s.mux.HandleFunc(prefix, func(w http.ResponseWriter, req *http.Request) {
+			target := prefix[strings.LastIndex(prefix, "/")+1:] + "/"
+
+			if req.URL.RawQuery != "" {
+				target += "?" + req.URL.RawQuery
+			}
+
+			w.Header().Set("Location", target)
+			w.WriteHeader(http.StatusMovedPermanently)
+		})
+	}
+
+	s.mux.Handle("/", files(cfg, fsys))
+
+	s.handler = s.mux
+
+	if cfg.base != "" {
+		base := http.NewServeMux()
+		base.Handle(cfg.base+"/", http.StripPrefix(cfg.base, s.mux))
+		base.Handle("/{$}", http.RedirectHandler(cfg.base+"/", http.StatusFound))
+
+		s.handler = base
+	}
+
+	if cfg.auth != "" {
+		user, pass, _ := strings.Cut(cfg.auth, ":")
+		s.handler = basicAuth(s.handler, user, pass)
+	}
+
+	// Preflight requests are sent without credentials, so CORS goes first.
+	if cfg.cors {
+		s.handler = cors(s.handler, cfg.corsOrigin)
+	}
+
+	if cfg.accessLog {
+		reload := cfg.base + cfg.reloadPath
+		s.handler = accessLog(s.handler, log, reload, reload+"/ws")
+	}
+
+	return s
+}
+
+// Reload tells all connected clients to reload.
+func (s *Server) Reload() {
+	s.reloader.notify("")
+}
+
+// ServeHTTP dispatches the request to the handlers of the Server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.handler.ServeHTTP(w, req)
+}
+
+// health reports that the server is up, for readiness checks.
+func (s *Server) health(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	json.NewEncoder(w).Encode(struct {
+		Status  string `json:"status"`
+		Clients int    `json:"clients"`
+		Root    string `json:"root"`
+	}{"ok", s.reloader.clientCount(), absolute(s.cfg.root)})
+}
+
+// ListenAndServe watches the root for changes and serves it on the configured addr.
+// When ctx is done the http.Server is shut down gracefully. With -no-serve
+// it only watches.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if s.cfg.noServe {
+		return s.watchOnly(ctx)
+	}
+
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	var reloadLn net.Listener
+
+	if s.cfg.reloadPort > 0 {
+		host, _, _ := net.SplitHostPort(s.cfg.addr)
+
+		if reloadLn, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(s.cfg.reloadPort))); err != nil {
+			return err
+		}
+		defer reloadLn.Close()
+	}
+
+	// The port may have been picked by the system.
+	if s.cfg.socket == "" {
+		host, _, _ := net.SplitHostPort(s.cfg.addr)
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+		s.cfg.addr = net.JoinHostPort(host, port)
+	}
+
+	var (
+		cfg    = s.cfg
+		rawurl = cfg.localURL()
+	)
+
+	if cfg.socket != "" {
+		rawurl = "unix:" + cfg.socket
+	}
+
+	if err := s.startWatching(ctx); err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:         cfg.addr,
+		Handler:      s,
+		ReadTimeout:  cfg.readTimeout,
+		WriteTimeout: cfg.writeTimeout,
+		IdleTimeout:  cfg.idleTimeout,
+	}
+
+	if cfg.secure() && (cfg.cert == "" || cfg.key == "") {
+		cert, err := selfSignedCert(certHosts(cfg.addr))
+		if err != nil {
+			return err
+		}
+
+		srv.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}
+	}
+
+	var reloadSrv *http.Server
+
+	if reloadLn != nil {
+		reloadSrv = &http.Server{
+			Handler:     s.reloads,
+			ReadTimeout: cfg.readTimeout,
+			IdleTimeout: cfg.idleTimeout,
+			TLSConfig:   srv.TLSConfig,
+		}
+
+		reloadSrv.RegisterOnShutdown(s.reloader.close)
+
+		go func() {
+			var err error
+
+			if cfg.secure() {
+				err = reloadSrv.ServeTLS(reloadLn, cfg.cert, cfg.key)
+			} else {
+				err = reloadSrv.Serve(reloadLn)
+			}
+
+			if !errors.Is(err, http.ErrServerClosed) {
+				s.log.Error("reload server failed", "event", "reload", "error", err)
+			}
+		}()
+	}
+
+	root := absolute(cfg.root)
+
+	s.log.Info(fmt.Sprintf("⟳ %s %q at %s", cfg.wait, root, rawurl),
+		"event", "start", "root", root, "url", rawurl, "wait", cfg.wait.String())
+
+	var networkURLs []string
+
+	if cfg.socket == "" {
+		networkURLs = cfg.networkURLs()
+	}
+
+	for _, u := range networkURLs {
+		s.log.Info("⟳ Network: "+u, "event", "network", "url", u)
+	}
+
+	if reloadLn != nil {
+		host, _, _ := net.SplitHostPort(cfg.addr)
+
+		if unspecified(host) {
+			host = "localhost"
+		}
+
+		u := cfg.scheme() + "://" + net.JoinHostPort(host, strconv.Itoa(cfg.reloadPort)) + cfg.reloadPath
+
+		s.log.Info("⟳ reloading from "+u, "event", "reload", "url", u)
+	}
+
+	if cfg.qr && cfg.socket == "" {
+		s.printQR(append(networkURLs, rawurl)[0])
+	}
+
+	s.logWatched(cfg.roots[1:])
+
+	if cfg.open && cfg.socket == "" {
+		openURL := rawurl
+
+		if cfg.openPath != "" {
+			openURL = strings.TrimRight(rawurl, "/") + "/" + strings.TrimLeft(cfg.openPath, "/")
+		}
+
+		// The listener is already accepting connections, queued until Serve, so
+		// the browser can be opened right away without racing the server.
+		go func() {
+			// Tabs left open from a previous run reconnect within a few retries.
+			if cfg.reuseTab {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(max(2*time.Second, 4*cfg.retry)):
+				}
+
+				if n := s.reloader.clientCount(); n > 0 {
+					s.log.Info("⟳ not opening the browser, a tab is already connected", "event", "open", "clients", n)
+
+					return
+				}
+			}
+
+			if cfg.browser != "" {
+				err := openWith(cfg.browser, openURL)
+				if err == nil {
+					return
+				}
+
+				s.log.Warn(fmt.Sprintf("⟳ could not open %s, using the default browser", cfg.browser),
+					"event", "open", "browser", cfg.browser, "error", err)
+			}
+
+			if err := openBrowser(openURL); err != nil {
+				s.log.Error("failed to open browser", "event", "open", "error", err)
+			}
+		}()
+	}
+
+	srv.RegisterOnShutdown(s.reloader.close)
+
+	shutdown := make(chan error, 1)
+
+	go func() {
+		<-ctx.Done()
+
+		s.log.Info("⟳ shutting down", "event", "shutdown")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		if reloadSrv != nil {
+			reloadSrv.Shutdown(ctx)
+		}
+
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
+	if cfg.secure() {
+		err = srv.ServeTLS(ln, cfg.cert, cfg.key)
+	} else {
+		err = srv.Serve(ln)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return <-shutdown
+	}
+
+	return err
+}
+
+// startWatching watches the roots for changes, and the config file if any.
+func (s *Server) startWatching(ctx context.Context) error {
+	if err := watch(ctx, s.cfg, s.hot, s.reloader, s.log); err != nil {
+		return err
+	}
+
+	if s.cfg.config == "" {
+		return nil
+	}
+
+	return s.watchConfig(ctx)
+}
+
+// watchOnly watches for changes, running any -exec commands, without serving
+// until ctx is done.
+func (s *Server) watchOnly(ctx context.Context) error {
+	if err := s.startWatching(ctx); err != nil {
+		return err
+	}
+
+	root := absolute(s.cfg.root)
+
+	s.log.Info(fmt.Sprintf("⟳ %s watching %q", s.cfg.wait, root),
+		"event", "start", "root", root, "wait", s.cfg.wait.String())
+
+	s.logWatched(s.cfg.roots[1:])
+
+	<-ctx.Done()
+
+	s.log.Info("⟳ shutting down", "event", "shutdown")
+
+	return nil
+}
+
+// logWatched logs the paths watched besides the root, or instead of it.
+func (s *Server) logWatched(watched []string) {
+	if len(s.cfg.watchPaths) > 0 {
+		watched = s.cfg.watchPaths
+	}
+
+	for _, path := range watched {
+		s.log.Info(fmt.Sprintf("⟳ watching %q", path), "event", "watch", "path", path)
+	}
+
+	if s.cfg.poll > 0 {
+		s.log.Info(fmt.Sprintf("⟳ polling every %s", s.cfg.poll), "event", "poll", "interval", s.cfg.poll.String())
+	}
+}
+
+// listen listens on the configured addr, trying the following ports and then
+// any free port if it is busy and -auto-port is given.
+func (s *Server) listen() (net.Listener, error) {
+	if s.cfg.socket != "" {
+		return listenUnix(s.cfg.socket)
+	}
+
+	ln, err := net.Listen("tcp", s.cfg.addr)
+	if err == nil || !s.cfg.autoPort {
+		return ln, err
+	}
+
+	host, port, _ := net.SplitHostPort(s.cfg.addr)
+
+	start, _ := strconv.Atoi(port)
+
+	for p := start + 1; p <= min(start+10, 65535); p++ {
+		if ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(p))); err == nil {
+			s.log.Warn(fmt.Sprintf("⟳ port %d is busy, using %d", start, p), "event", "port", "port", strconv.Itoa(p))
+
+			return ln, nil
+		}
+	}
+
+	if ln, err = net.Listen("tcp", net.JoinHostPort(host, "0")); err != nil {
+		return nil, err
+	}
+
+	_, port, _ = net.SplitHostPort(ln.Addr().String())
+
+	s.log.Warn(fmt.Sprintf("⟳ port %d is busy, using %s", start, port), "event", "port", "port", port)
+
+	return ln, nil
+}
+
+// listenUnix listens on the socket at path, replacing a stale socket left
+// behind by a previous run. The socket is removed when the listener is closed.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+func (cfg Config) secure() bool {
+	return cfg.tls || (cfg.cert != "" && cfg.key != "")
+}
+
+func (cfg Config) scheme() string {
+	if cfg.secure() {
+		return "https"
+	}
+
+	return "http"
+}
+
+func (cfg Config) url(host string) string {
+	_, port, _ := net.SplitHostPort(cfg.addr)
+
+	u := cfg.scheme() + "://" + net.JoinHostPort(host, port)
+
+	if cfg.base != "" {
+		u += cfg.base + "/"
+	}
+
+	return u
+}
+
+// waitFor returns how long to wait before reloading after path changes.
+func (cfg Config) waitFor(path string) time.Duration {
+	if d, ok := cfg.waits[strings.ToLower(filepath.Ext(path))]; ok {
+		return d
+	}
+
+	return cfg.wait
+}
+
+// localURL is the URL to open in a browser on this machine.
+func (cfg Config) localURL() string {
+	host, _, _ := net.SplitHostPort(cfg.addr)
+
+	if unspecified(host) {
+		host = "localhost"
+	}
+
+	return cfg.url(host)
+}
+
+// networkURLs are the URLs other devices on the LAN can use, when listening
+// on all interfaces.
+func (cfg Config) networkURLs() []string {
+	host, _, _ := net.SplitHostPort(cfg.addr)
+
+	if !unspecified(host) {
+		return nil
+	}
+
+	var urls []string
+
+	for _, ip := range lanIPs() {
+		urls = append(urls, cfg.url(ip.String()))
+	}
+
+	return urls
+}
+
+func (s *Server) printQR(rawurl string) {
+	modules, err := qrEncode(rawurl)
+	if err != nil {
+		s.log.Error("failed to encode QR code", "event", "qr", "error", err)
+
+		return
+	}
+
+	s.log.Info(strings.TrimSuffix(qrString(modules), "\n"), "event", "qr", "url", rawurl)
+}
+
+func unspecified(host string) bool {
+	if host == "" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsUnspecified()
+}
+
+// lanIPs returns the non-loopback IPv4 addresses of the interfaces that are up.
+func lanIPs() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var ips []net.IP
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok {
+				if ip4 := ipnet.IP.To4(); ip4 != nil && !ip4.IsLoopback() {
+					ips = append(ips, ip4)
+				}
+			}
+		}
+	}
+
+	return ips
+}
+
+// watchGroup names the files matching a glob relative to the root, where **
+// matches any number of directories.
+type watchGroup struct {
+	name string
+	glob string
+}
+
+type watchState struct {
+	mu       sync.Mutex
+	seen     map[string]os.FileInfo
+	pending  map[string]struct{}
+	timer    *time.Timer
+	first    time.Time // of the pending changes
+	maxWait  time.Duration
+	roots    []string
+	mounts   map[string]string
+	commands []string
+	notify   bool
+	exts     map[string]bool
+	groups   []watchGroup
+	cancel   context.CancelFunc  // of the build in progress
+	building map[string]struct{} // changes of the build in progress
+	build    sync.Mutex
+	log      *slog.Logger
+}
+
+func newWatchState(cfg Config, log *slog.Logger) *watchState {
+	return &watchState{
+		seen:     make(map[string]os.FileInfo),
+		pending:  make(map[string]struct{}),
+		maxWait:  cfg.maxWait,
+		roots:    cfg.roots,
+		mounts:   cfg.mounts,
+		commands: cfg.exec,
+		notify:   cfg.notify,
+		exts:     cfg.watchExts,
+		groups:   cfg.watchGroups,
+		log:      log,
+	}
+}
+
+func (ws *watchState) trigger(path string, delay time.Duration, r *reloader) {
+	// Directories are still watched, so that new files with the extensions are seen.
+	if len(ws.exts) > 0 && !ws.exts[strings.ToLower(filepath.Ext(path))] {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if last, ok := ws.seen[path]; ok && unchanged(last, info) {
+		return
+	}
+
+	ws.seen[path] = info
+
+	if len(ws.pending) == 0 {
+		ws.first = time.Now()
+	}
+
+	ws.pending[path] = struct{}{}
+
+	if ws.timer != nil {
+		ws.timer.Stop()
+	}
+
+	// Do not let a continuous stream of changes postpone the reload forever.
+	if ws.maxWait > 0 {
+		delay = max(0, min(delay, ws.maxWait-time.Since(ws.first)))
+	}
+
+	ws.timer = time.AfterFunc(delay, func() { ws.flush(r) })
+}
+
+func (ws *watchState) flush(r *reloader) {
+	ws.mu.Lock()
+	pending := ws.pending
+	ws.pending = make(map[string]struct{})
+
+	var ctx context.Context
+
+	if len(ws.commands) > 0 {
+		// A build still running is stale, so it is canceled and its
+		// changes are included in this one instead.
+		if ws.cancel != nil {
+			ws.cancel()
+			maps.Copy(pending, ws.building)
+		}
+
+		ctx, ws.cancel = context.WithCancel(context.Background())
+		ws.building = pending
+	}
+
+	ws.mu.Unlock()
+
+	if len(ws.commands) > 0 {
+		ws.build.Lock()
+		defer ws.build.Unlock()
+
+		step, output, err := runCommands(ctx, ws.commands)
+
+		ws.mu.Lock()
+
+		if ctx.Err() != nil {
+			ws.mu.Unlock()
+			ws.log.Debug("⟳ canceled stale build", "event", "exec")
+
+			return
+		}
+
+		ws.cancel()
+		ws.cancel, ws.building = nil, nil
+		ws.mu.Unlock()
+
+		if err != nil {
+			command := ws.commands[step]
+
+			ws.log.Error("exec error", "event", "exec", "command", command, "step", step+1, "error", err)
+
+			if len(output) == 0 {
+				output = []byte(err.Error())
+			}
+
+			if len(ws.commands) > 1 {
+				output = fmt.Appendf(nil, "step %d of %d failed: %s\n\n%s", step+1, len(ws.commands), command, output)
+			}
+
+			if ws.notify {
+				if err := desktopNotify("live: build failed", firstLine(string(output))); err != nil {
+					ws.log.Debug("⟳ could not show a notification", "event", "notify", "error", err)
+				}
+			}
+
+			r.fail(string(output))
+
+			return
+		}
+	}
+
+	var (
+		paths  []string
+		groups []string
+		soft   = true
+	)
+
+	for path := range pending {
+		// Temporary files of atomic saves are gone by now.
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		ws.log.Debug("⟳ reload triggered by "+path, "event", "trigger", "path", path)
+
+		paths = append(paths, ws.urlPath(path))
+		groups = append(groups, ws.group(path))
+		soft = soft && softReload(path)
+	}
+
+	if len(paths) == 0 {
+		return
+	}
+
+	// The changes of a whole burst are coalesced into a single reload.
+	noun := "files"
+	if len(paths) == 1 {
+		noun = "file"
+	}
+
+	ws.log.Info(fmt.Sprintf("⟳ %d %s changed", len(paths), noun), "event", "changed", "files", len(paths))
+
+	if len(paths) > 1 && !soft {
+		group := groups[0]
+
+		for _, g := range groups {
+			if g != group {
+				group = ""
+			}
+		}
+
+		r.notifyGroup("", group)
+
+		return
+	}
+
+	// All stylesheets are swapped at once, so one reload per group will do.
+	css := map[string]bool{}
+
+	for i, p := range paths {
+		if strings.EqualFold(filepath.Ext(p), ".css") {
+			if css[groups[i]] {
+				continue
+			}
+
+			css[groups[i]] = true
+		}
+
+		r.notifyGroup(p, groups[i])
+	}
+}
+
+// group returns the name of the first -watch-group matching path, if any.
+func (ws *watchState) group(path string) string {
+	rel, ok := relativePath(ws.roots, path)
+	if !ok {
+		return ""
+	}
+
+	for _, g := range ws.groups {
+		if matchSegments(strings.Split(g.glob, "/"), strings.Split(rel, "/")) {
+			return g.name
+		}
+	}
+
+	return ""
+}
+
+// softReload reports if the client can apply changes to path without
+// reloading the page, by swapping stylesheets and images.
+func softReload(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".css", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".avif", ".ico":
+		return true
+	}
+
+	return false
+}
+
+// urlPath returns the escaped URL path of a file in one of the watched roots.
+func (ws *watchState) urlPath(path string) string {
+	for prefix, dir := range ws.mounts {
+		if rel, ok := relativePath([]string{dir}, path); ok {
+			return (&url.URL{Path: prefix + "/" + rel}).EscapedPath()
+		}
+	}
+
+	rel, ok := relativePath(ws.roots, path)
+	if !ok {
+		rel = filepath.Base(path)
+	}
+
+	return (&url.URL{Path: "/" + rel}).EscapedPath()
+}
+
+// relativePath returns path relative to the first of roots containing it,
+// slash separated.
+func relativePath(roots []string, path string) (string, bool) {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		return filepath.ToSlash(rel), true
+	}
+
+	return "", false
+}
+
+// unchanged reports if b is the same file as a, with the same size and
+// modification time. Comparing the files catches editors that save by
+// renaming a new file over the old one, which can keep the modification time
+// when it has a coarse resolution.
+func unchanged(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// forget drops what was seen of path, and of anything below it in case it was
+// a directory.
+func (ws *watchState) forget(path string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	prefix := path + string(filepath.Separator)
+
+	for name := range ws.seen {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(ws.seen, name)
+		}
+	}
+}
+
+// record stores what is seen of path without triggering a reload.
+func (ws *watchState) record(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.seen[path] = info
+}
+
+// watchDirRecursive watches root and its subdirectories, returning the number
+// of directories that could not be watched along with the first error.
+func watchDirRecursive(w *fsnotify.Watcher, root string, ignored *ignorer, follow bool, log *slog.Logger) (int, error) {
+	var (
+		failed int
+		first  error
+	)
+
+	walkDir(root, follow, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if isIgnored(path, ignored) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if d.IsDir() {
+			if err := w.Add(path); err != nil {
+				log.Debug("⟳ could not watch "+path, "event", "watch", "path", path, "error", err)
+
+				if failed == 0 {
+					first = err
+				}
+
+				failed++
+			}
+		}
+
+		return nil
+	})
+
+	return failed, first
+}
+
+// rewatch brings the watches of w in line with a changed ignorer, watching the
+// directories that are no longer ignored and unwatching those that now are.
+func rewatch(w *fsnotify.Watcher, roots []string, ignored *ignorer, follow bool, log *slog.Logger) {
+	dirs := map[string]bool{}
+
+	for _, root := range roots {
+		walkDir(root, follow, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			if isIgnored(path, ignored) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if d.IsDir() {
+				dirs[path] = true
+			}
+
+			return nil
+		})
+	}
+
+	for _, path := range w.WatchList() {
+		if !dirs[path] {
+			w.Remove(path)
+		}
+	}
+
+	var (
+		failed int
+		first  error
+	)
+
+	// Adding a directory that is already watched does nothing.
+	for path := range dirs {
+		if err := w.Add(path); err != nil {
+			log.Debug("⟳ could not watch "+path, "event", "watch", "path", path, "error", err)
+
+			if failed == 0 {
+				first = err
+			}
+
+			failed++
+		}
+	}
+
+	warnWatchFailures(log, failed, first)
+}
+
+// listWatched prints the directories watchDirRecursive would watch, and the
+// paths it would skip along with the pattern ignoring them.
+func listWatched(cfg Config, w io.Writer) error {
+	ignored, err := newIgnorer(cfg)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.watchPaths) > 0 {
+		for _, path := range cfg.watchPaths {
+			fmt.Fprintln(w, "watch  "+path)
+		}
+
+		return nil
+	}
+
+	for _, root := range cfg.roots {
+		walkDir(root, cfg.followSymlinks, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				fmt.Fprintf(w, "error  %s: %v\n", path, err)
+
+				return nil
+			}
+
+			if pattern, ok := ignoredBy(path, ignored); ok {
+				fmt.Fprintf(w, "ignore %s (%s)\n", path, pattern)
+
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if d.IsDir() {
+				fmt.Fprintln(w, "watch  "+path)
+			}
+
+			return nil
+		})
+	}
+
+	return nil
+}
+
+// unwatchDir removes the watches of a directory that was removed or renamed,
+// including its subdirectories. Watches of renamed directories would otherwise
+// keep reporting events under the old path. If a directory shows up again,
+// it is watched anew when its Create event arrives.
+func unwatchDir(w *fsnotify.Watcher, path string) {
+	path = filepath.Clean(path)
+	prefix := path + string(filepath.Separator)
+
+	for _, name := range w.WatchList() {
+		if name == path || strings.HasPrefix(name, prefix) {
+			_ = w.Remove(name)
+		}
+	}
+}
+
+// warnWatchFailures explains what to do when directories could not be watched,
+// which on Linux usually means that fs.inotify.max_user_watches was reached.
+func warnWatchFailures(log *slog.Logger, failed int, err error) {
+	if failed == 0 {
+		return
+	}
+
+	log.Warn(fmt.Sprintf("⟳ could not watch %d directories, changes in them will not reload; "+
+		"raise fs.inotify.max_user_watches, ignore large directories or use -poll", failed),
+		"event", "watch", "failed", failed, "error", err)
+}
+
+// walkDir is filepath.WalkDir, optionally following symlinked directories.
+// Paths are reported below the symlink, and each real directory is walked
+// once, which guards against cycles.
+func walkDir(root string, follow bool, fn fs.WalkDirFunc) error {
+	real, err := filepath.EvalSymlinks(root)
+	if !follow || err != nil {
+		return filepath.WalkDir(root, fn)
+	}
+
+	visited := map[string]bool{}
+
+	var walk func(path, real string) error
+
+	walk = func(path, real string) error {
+		if visited[real] {
+			return nil
+		}
+
+		visited[real] = true
+
+		return filepath.WalkDir(real, func(p string, d fs.DirEntry, err error) error {
+			rel, _ := filepath.Rel(real, p)
+			p = filepath.Join(path, rel)
+
+			if err == nil && d.Type()&fs.ModeSymlink != 0 {
+				if target, err := filepath.EvalSymlinks(p); err == nil {
+					if info, err := os.Stat(target); err == nil && info.IsDir() {
+						return walk(p, target)
+					}
+				}
+			}
+
+			return fn(p, d, err)
+		})
+	}
+
+	return walk(root, real)
+}
+
+func walkFiles(roots []string, ignored *ignorer, follow bool, fn func(path string)) {
+	for _, root := range roots {
+		walkDir(root, follow, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			if isIgnored(path, ignored) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if !d.IsDir() {
+				fn(path)
+			}
+
+			return nil
+		})
+	}
+}
+
+// watchList holds the paths given as arguments, watched instead of the roots.
+// Directories are watched without their subdirectories, and files through
+// their parent directory, so that atomic saves are noticed.
+type watchList struct {
+	files map[string]bool
+	dirs  map[string]bool
+}
+
+func newWatchList(paths []string) (*watchList, error) {
+	wl := &watchList{files: map[string]bool{}, dirs: map[string]bool{}}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		path = filepath.Clean(path)
+
+		if info.IsDir() {
+			wl.dirs[path] = true
+		} else {
+			wl.files[path] = true
+		}
+	}
+
+	return wl, nil
+}
+
+func (wl *watchList) contains(path string) bool {
+	path = filepath.Clean(path)
+
+	return wl.files[path] || wl.dirs[filepath.Dir(path)]
+}
+
+func (wl *watchList) add(w *fsnotify.Watcher) (int, error) {
+	var (
+		failed int
+		first  error
+	)
+
+	dirs := maps.Clone(wl.dirs)
+
+	for file := range wl.files {
+		dirs[filepath.Dir(file)] = true
+	}
+
+	for dir := range dirs {
+		if err := w.Add(dir); err != nil {
+			if failed == 0 {
+				first = err
+			}
+
+			failed++
+		}
+	}
+
+	return failed, first
+}
+
+func (wl *watchList) walk(ignored *ignorer, fn func(path string)) {
+	for file := range wl.files {
+		fn(file)
+	}
+
+	for dir := range wl.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if path := filepath.Join(dir, entry.Name()); !entry.IsDir() && !isIgnored(path, ignored) {
+				fn(path)
+			}
+		}
+	}
+}
+
+// poll is used instead of fsnotify on filesystems that do not deliver events,
+// such as network mounts and some container volumes.
+func poll(ctx context.Context, cfg Config, hot *hotConfig, r *reloader, log *slog.Logger, walk func(fn func(path string))) {
+	ws := newWatchState(cfg, log)
+
+	walk(ws.record)
+
+	ticker := time.NewTicker(cfg.poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			live, _ := hot.get()
+
+			walk(func(path string) {
+				ws.trigger(path, live.waitFor(path), r)
+			})
+		}
+	}
+}
+
+func watch(ctx context.Context, cfg Config, hot *hotConfig, r *reloader, log *slog.Logger) error {
+	ignored, err := newIgnorer(cfg)
+	if err != nil {
+		return err
+	}
+
+	hot.set(cfg, ignored)
+
+	var list *watchList
+
+	if len(cfg.watchPaths) > 0 {
+		if list, err = newWatchList(cfg.watchPaths); err != nil {
+			return err
+		}
+	}
+
+	if cfg.poll > 0 {
+		walk := func(fn func(path string)) {
+			_, ignored := hot.get()
+			walkFiles(cfg.roots, ignored, cfg.followSymlinks, fn)
+		}
+
+		if list != nil {
+			walk = func(fn func(path string)) {
+				_, ignored := hot.get()
+				list.walk(ignored, fn)
+			}
+		}
+
+		go poll(ctx, cfg, hot, r, log, walk)
+
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	var (
+		failed int
+		first  error
+	)
+
+	if list != nil {
+		failed, first = list.add(watcher)
+	} else {
+		for _, root := range cfg.roots {
+			n, err := watchDirRecursive(watcher, root, ignored, cfg.followSymlinks, log)
+
+			if failed == 0 {
+				first = err
+			}
+
+			failed += n
+		}
+	}
+
+	warnWatchFailures(log, failed, first)
+
+	ws := newWatchState(cfg, log)
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-watcher.Events:
+				live, ignored := hot.get()
+
+				if isIgnored(ev.Name, ignored) || (list != nil && !list.contains(ev.Name)) {
+					continue
+				}
+
+				log.Debug(fmt.Sprintf("⟳ %s %s", ev.Op, ev.Name), "event", "fsnotify", "op", ev.Op.String(), "path", ev.Name)
+
+				if ev.Op&fsnotify.Create != 0 && list == nil {
+					if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+						failed, err := watchDirRecursive(watcher, ev.Name, ignored, cfg.followSymlinks, log)
+						warnWatchFailures(log, failed, err)
+					}
+				}
+
+				if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					unwatchDir(watcher, ev.Name)
+					ws.forget(ev.Name)
+				}
+
+				// Editors saving atomically write a temporary file and
+				// rename it to the final name, which shows up as a Create.
+				if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					ws.trigger(ev.Name, live.waitFor(ev.Name), r)
+				}
+			case <-hot.rewatch:
+				if list == nil {
+					_, ignored := hot.get()
+					rewatch(watcher, cfg.roots, ignored, cfg.followSymlinks, log)
+				}
+			case err := <-watcher.Errors:
+				log.Error("watch error", "event", "watch", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func newRootFunc(cfg Config, fsys fs.FS) func(http.ResponseWriter, *http.Request) {
+	files := http.FileServerFS(fsys)
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		name := fsName(req.URL.Path)
+
+		if cfg.noDotfiles && isDotfile(name) {
+			http.NotFound(w, req)
+
+			return
+		}
+
+		if !within(cfg.root, filepath.Join(cfg.root, filepath.FromSlash(name)), cfg.followSymlinks) {
+			http.NotFound(w, req)
+
+			return
+		}
+
+		if cfg.cleanURLs {
+			if target, ok := cleanURL(fsys, req.URL.Path, name); ok {
+				if req.URL.RawQuery != "" {
+					target += "?" + req.URL.RawQuery
+				}
+
+				// A relative redirect, like http.FileServer, to keep any stripped prefix.
+				w.Header().Set("Location", target)
+				w.WriteHeader(http.StatusMovedPermanently)
+
+				return
+			}
+
+			if _, err := fs.Stat(fsys, name); os.IsNotExist(err) {
+				if info, err := fs.Stat(fsys, name+".html"); err == nil && !info.IsDir() {
+					name += ".html"
+				}
+			}
+		}
+
+		info, err := fs.Stat(fsys, name)
+		if err == nil && info.IsDir() {
+			if index, ok := findIndex(fsys, name, cfg.indexes); ok {
+				req.URL.Path = filepath.ToSlash(filepath.Join(req.URL.Path, index))
+				name = fsJoin(name, index)
+			} else if cfg.listing && strings.HasSuffix(req.URL.Path, "/") {
+				serveListing(w, req, fsys, name, cfg)
+
+				return
+			}
+		}
+
+		if os.IsNotExist(err) && cfg.spa && wantsHTML(req) {
+			if index, ok := findIndex(fsys, ".", cfg.indexes); ok {
+				name = index
+			}
+		}
+
+		if info, err := fs.Stat(fsys, name); err == nil &&
+			!info.IsDir() && isHTML(name) {
+			if data, err := fs.ReadFile(fsys, name); err == nil {
+				serveHTML(w, req, data, info.ModTime(), cfg)
+
+				return
+			}
+		}
+
+		if info, err := fs.Stat(fsys, name); err == nil &&
+			!info.IsDir() && cfg.templates && filepath.Ext(name) == templateExt {
+			page, err := renderTemplate(cfg, fsys, name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+
+				return
+			}
+
+			// The page may depend on other templates and the data file.
+			serveHTML(w, req, page, time.Now(), cfg)
+
+			return
+		}
+
+		if info, err := fs.Stat(fsys, name); err == nil &&
+			!info.IsDir() && cfg.markdown && strings.EqualFold(filepath.Ext(name), ".md") {
+			if data, err := fs.ReadFile(fsys, name); err == nil {
+				page, err := renderMarkdown(data, filepath.Base(name))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+
+					return
+				}
+
+				serveHTML(w, req, page, info.ModTime(), cfg)
+
+				return
+			}
+		}
+
+		if cfg.cacheControl != "" {
+			w.Header().Set("Cache-Control", cfg.cacheControl)
+		}
+
+		if ctype, ok := cfg.mimeTypes[strings.ToLower(filepath.Ext(name))]; ok {
+			w.Header().Set("Content-Type", ctype)
+		}
+
+		if serveCompressed(w, req, fsys, name, cfg.mimeTypes) {
+			return
+		}
+
+		if info, err := fs.Stat(fsys, name); err == nil && !info.IsDir() {
+			precompressedWasm(w.Header(), req, name, cfg.mimeTypes)
+		}
+
+		if _, err := fs.Stat(fsys, name); os.IsNotExist(err) && cfg.wasmExec && req.URL.Path == "/wasm_exec.js" {
+			if name, err := wasmExecPath(); err == nil {
+				http.ServeFile(w, req, name)
+
+				return
+			}
+		}
+
+		if _, err := fs.Stat(fsys, name); os.IsNotExist(err) && cfg.githubPages {
+			if data, err := fs.ReadFile(fsys, notFoundPage); err == nil {
+				serveNotFound(w, req, data, cfg)
+
+				return
+			}
+		}
+
+		files.ServeHTTP(w, req)
+	}
+}
+
+// fsName returns the name in an fs.FS of the file at urlPath.
+func fsName(urlPath string) string {
+	if name := strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+urlPath)), "/"); name != "" {
+		return name
+	}
+
+	return "."
+}
+
+// isDotfile reports if any segment of name starts with a dot.
+func isDotfile(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") && segment != "." {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fsJoin joins the name of a directory in an fs.FS with the name of an entry.
+func fsJoin(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+
+	return dir + "/" + name
+}
+
+// setHeaders wraps next, setting headers on every response.
+func setHeaders(next http.Handler, hot *hotConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cfg, _ := hot.get()
+
+		for name, values := range cfg.headers {
+			w.Header()[name] = slices.Clone(values)
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// serveHTML serves a page modified at mod, injecting the reload script.
+func serveHTML(w http.ResponseWriter, req *http.Request, data []byte, mod time.Time, cfg Config) {
+	nonce := false
+
+	if !cfg.noInject {
+		var snippet []byte
+
+		snippet, nonce = allowSnippet(w.Header(), cfg.snippet)
+		data = injectReload(data, snippet, cfg.inject)
+	}
+
+	setPageCacheControl(w.Header(), nonce)
+
+	if nonce {
+		mod = time.Time{}
+	} else {
+		w.Header().Set("ETag", weakETag(data))
+	}
+
+	// ServeContent handles conditional and range requests for the page.
+	w.Header().Set("Content-Type", "text/html")
+	http.ServeContent(w, req, "", mod, bytes.NewReader(data))
+}
+
+// notFoundPage is served for missing paths with -github-pages.
+const notFoundPage = "404.html"
+
+// serveNotFound serves the notFoundPage data with a 404 Not Found status,
+// leaving the missing path to any client-side routing in the page.
+func serveNotFound(w http.ResponseWriter, req *http.Request, data []byte, cfg Config) {
+	nonce := false
+
+	if !cfg.noInject {
+		var snippet []byte
+
+		snippet, nonce = allowSnippet(w.Header(), cfg.snippet)
+		data = injectReload(data, snippet, cfg.inject)
+	}
+
+	setPageCacheControl(w.Header(), nonce)
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusNotFound)
+
+	if req.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// weakETag is computed over the served bytes, rather than the file, so that
+// it changes along with the injected script.
+func weakETag(data []byte) string {
+	h := fnv.New64a()
+	h.Write(data)
+
+	return fmt.Sprintf(`W/"%016x"`, h.Sum64())
+}
+
+// cleanURL returns the relative URL to redirect an existing .html file to,
+// without its extension, or the directory itself for an index.html.
+func cleanURL(fsys fs.FS, urlPath, name string) (string, bool) {
+	if !strings.HasSuffix(urlPath, ".html") {
+		return "", false
+	}
+
+	if info, err := fs.Stat(fsys, name); err != nil || info.IsDir() {
+		return "", false
+	}
+
+	base := urlPath[strings.LastIndex(urlPath, "/")+1:]
+
+	if base == "index.html" {
+		return "./", true
+	}
+
+	return strings.TrimSuffix(base, ".html"), true
+}
+
+// within reports if path is inside root, after resolving any symlinks
+// unless they are to be followed.
+func within(root, path string, follow bool) bool {
+	if follow {
+		root, path = absolute(root), absolute(path)
+	} else {
+		root, path = resolve(root), resolve(path)
+	}
+
+	prefix := root
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+
+	return path == root || strings.HasPrefix(path, prefix)
+}
+
+func absolute(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return path
+}
+
+func resolve(path string) string {
+	path = absolute(path)
+
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+
+	return path
+}
+
+// wasmExecPath returns the path of the wasm_exec.js shipped with Go, which
+// moved from misc/wasm to lib/wasm in Go 1.24.
+var wasmExecPath = sync.OnceValues(func() (string, error) {
+	out, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		return "", err
+	}
+
+	goroot := strings.TrimSpace(string(out))
+
+	for _, dir := range []string{"lib/wasm", "misc/wasm"} {
+		name := filepath.Join(goroot, filepath.FromSlash(dir), "wasm_exec.js")
+
+		if _, err := os.Stat(name); err == nil {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("wasm_exec.js not found in %s", goroot)
+})
+
+// findIndex returns the first of names that is a file in dir.
+func findIndex(fsys fs.FS, dir string, names []string) (string, bool) {
+	for _, name := range names {
+		if info, err := fs.Stat(fsys, fsJoin(dir, name)); err == nil && !info.IsDir() {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+func isHTML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return true
+	}
+
+	return false
+}
+
+func wantsHTML(req *http.Request) bool {
+	if filepath.Ext(req.URL.Path) != "" && !isHTML(req.URL.Path) {
+		return false
+	}
+
+	return strings.Contains(req.Header.Get("Accept"), "text/html")
+}
+
+// runCommands runs commands in order, stopping at the first one that fails.
+// The index of that one is returned along with its output.
+func runCommands(ctx context.Context, commands []string) (int, []byte, error) {
+	for i, command := range commands {
+		if output, err := runCommand(ctx, command); err != nil {
+			return i, output, err
+		}
+	}
+
+	return 0, nil, nil
+}
+
+// runCommand runs command through the shell, streaming its output to the
+// terminal and returning what it wrote to stderr.
+func runCommand(ctx context.Context, command string) ([]byte, error) {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.CommandContext(ctx, "cmd", "/c", command)
+	default:
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	killGroup(cmd)
+
+	var stderr bytes.Buffer
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := cmd.Run()
+
+	return stderr.Bytes(), err
+}
+
+// openBrowser opens url using the commands in $BROWSER, falling back to the
+// default browser of the system.
+func openBrowser(url string) error {
+	if env := os.Getenv("BROWSER"); env != "" {
+		// Like xdg-open, each command is tried in turn, with %s replaced by
+		// the URL, which is otherwise the last argument.
+		for _, command := range filepath.SplitList(env) {
+			args := strings.Fields(command)
+			if len(args) == 0 {
+				continue
+			}
+
+			if strings.Contains(command, "%s") {
+				for i := range args {
+					args[i] = strings.ReplaceAll(args[i], "%s", url)
+				}
+			} else {
+				args = append(args, url)
+			}
+
+			if exec.Command(args[0], args[1:]...).Start() == nil {
+				return nil
+			}
+		}
+	}
+
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	return cmd.Start()
+}
+
+// desktopNotify shows a notification, on a best-effort basis.
+func desktopNotify(title, message string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run", title, message)
+	case "windows":
+		quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+
+		cmd = exec.Command("powershell", "-NoProfile", "-Command",
+			"Add-Type -AssemblyName System.Windows.Forms; $n = New-Object System.Windows.Forms.NotifyIcon; "+
+				"$n.Icon = [System.Drawing.SystemIcons]::Error; $n.Visible = $true; "+
+				"$n.ShowBalloonTip(5000, "+quote(title)+", "+quote(message)+", 'Error'); Start-Sleep 6; $n.Dispose()")
+	default:
+		cmd = exec.Command("notify-send", "--urgency=critical", title, message)
+	}
+
+	return cmd.Start()
+}
+
+// firstLine returns the first non-empty line of s, shortened for notifications.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if len(line) > 200 {
+				line = line[:200] + "…"
+			}
+
+			return line
+		}
+	}
+
+	return s
+}
+
+// browsers maps browser names to the applications used on macOS, and the
+// executables looked for elsewhere.
+var browsers = map[string]struct {
+	app  string
+	bins []string
+}{
+	"chrome":   {"Google Chrome", []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "chrome"}},
+	"chromium": {"Chromium", []string{"chromium", "chromium-browser"}},
+	"firefox":  {"Firefox", []string{"firefox"}},
+	"safari":   {"Safari", nil},
+	"edge":     {"Microsoft Edge", []string{"microsoft-edge", "microsoft-edge-stable", "msedge"}},
+	"brave":    {"Brave Browser", []string{"brave-browser", "brave"}},
+}
+
+// openWith opens url in the named browser, or the executable at that path.
+func openWith(browser, url string) error {
+	b, ok := browsers[strings.ToLower(browser)]
+	if !ok {
+		return exec.Command(browser, url).Start()
+	}
+
+	if runtime.GOOS == "darwin" {
+		// open fails right away if the application is not installed.
+		return exec.Command("open", "-a", b.app, url).Run()
+	}
+
+	for _, bin := range b.bins {
+		if path, err := exec.LookPath(bin); err == nil {
+			return exec.Command(path, url).Start()
+		}
+	}
+
+	return fmt.Errorf("%s not found", browser)
+}
+
+type reloader struct {
+	log         *slog.Logger
+	heartbeat   time.Duration
+	retry       time.Duration
+	minInterval time.Duration
+	maxClients  int
+	mu          sync.Mutex
+	clients     map[chan string]struct{}
+	lastErr     string
+	reloads     int
+	started     time.Time
+	sent        time.Time // of the last reload
+	queued      string    // to be sent once minInterval has passed
+	scrollSent  time.Time
+	scrolled    string // to be relayed once scrollInterval has passed
+}
+
+func newReloader(cfg Config, log *slog.Logger) *reloader {
+	return &reloader{
+		log:         log,
+		heartbeat:   cfg.heartbeat,
+		retry:       cfg.retry,
+		minInterval: cfg.minInterval,
+		maxClients:  cfg.maxClients,
+		clients:     make(map[chan string]struct{}),
+		started:     time.Now(),
+	}
+}
+
+func (r *reloader) endpoint(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// Connection headers are not allowed in HTTP/2, which keeps streams open.
+	if req.ProtoMajor == 1 {
+		w.Header().Set("Connection", "keep-alive")
+	}
+
+	// The stream is meant to stay open, so lift the deadlines set by the
+	// server for -read-timeout and -write-timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	ch, ok := r.add()
+	if !ok {
+		http.Error(w, "too many clients", http.StatusServiceUnavailable)
+
+		return
+	}
+	defer r.remove(ch)
+
+	// Some browsers only consider the stream open once the first bytes arrive.
+	if r.retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n", r.retry.Milliseconds())
+	}
+
+	fmt.Fprint(w, ": connected\n\n")
+
+	// The controller also reaches the Flusher of wrapped writers, such as
+	// those of middleware. Without one events are sent as the buffer fills.
+	if err := rc.Flush(); errors.Is(err, http.ErrNotSupported) {
+		r.log.Warn("⟳ reload stream cannot be flushed, reloads may be delayed", "event", "flush", "error", err)
+	}
+
+	// Keep idle connections from being closed by proxies and browsers.
+	var ping <-chan time.Time
+
+	if r.heartbeat > 0 {
+		ticker := time.NewTicker(r.heartbeat)
+		defer ticker.Stop()
+
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ping:
+			fmt.Fprint(w, ": ping\n\n")
+			_ = rc.Flush()
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			fmt.Fprintf(w, "data: %s\n\n", msg)
+			_ = rc.Flush()
+		}
+	}
+}
+
+// trigger lets external tools request a reload, optionally passing the
+// changed path as {"path": "..."} so that stylesheets can be swapped.
+func (r *reloader) trigger(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	// Paths are compared to those of the page, which start with a slash.
+	if body.Path != "" && !strings.HasPrefix(body.Path, "/") {
+		body.Path = "/" + body.Path
+	}
+
+	r.notify(body.Path)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// stats reports the number of reloads sent since the start, so that tests can
+// wait for a reload instead of sleeping.
+func (r *reloader) stats(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	json.NewEncoder(w).Encode(struct {
+		Reloads int     `json:"reloads"`
+		Clients int     `json:"clients"`
+		Uptime  float64 `json:"uptime"`
+	}{r.reloads, len(r.clients), time.Since(r.started).Seconds()})
+}
+
+// reload makes all clients reload the page, even with -reload soft, and
+// reports how many there were. With mode=auto it is like a file change.
+func (r *reloader) reload(w http.ResponseWriter, req *http.Request) {
+	var n int
+
+	switch mode := req.URL.Query().Get("mode"); mode {
+	case "", "full":
+		n = r.hardReload()
+	case "auto":
+		n = r.clientCount()
+		r.notify("")
+	default:
+		http.Error(w, fmt.Sprintf("unknown reload mode %q", mode), http.StatusBadRequest)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(struct {
+		Clients int `json:"clients"`
+	}{n})
+}
+
+// add registers a new client, unless there are already -max-clients.
+func (r *reloader) add() (chan string, bool) {
+	r.mu.Lock()
+
+	if r.maxClients > 0 && len(r.clients) >= r.maxClients {
+		r.log.Warn(fmt.Sprintf("⟳ client refused, -max-clients %d reached", r.maxClients), "event", "refuse", "clients", len(r.clients))
+		r.mu.Unlock()
+
+		return nil, false
+	}
+
+	ch := make(chan string, 8)
+	r.clients[ch] = struct{}{}
+
+	if r.lastErr != "" {
+		ch <- errorMessage(r.lastErr)
+	}
+
+	r.log.Debug(fmt.Sprintf("⟳ client connected (%d clients)", len(r.clients)), "event", "connect", "clients", len(r.clients))
+
+	r.mu.Unlock()
+
+	return ch, true
+}
+
+func (r *reloader) remove(ch chan string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.clients[ch]; ok {
+		delete(r.clients, ch)
+		close(ch)
+
+		r.log.Debug(fmt.Sprintf("⟳ client disconnected (%d clients)", len(r.clients)), "event", "disconnect", "clients", len(r.clients))
+	}
+}
+
+// clientCount returns the number of connected clients.
+func (r *reloader) clientCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.clients)
+}
+
+func (r *reloader) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ch := range r.clients {
+		delete(r.clients, ch)
+		close(ch)
+	}
+}
+
+// notify tells all clients to reload, passing along the URL path of the
+// changed file so that stylesheets and images can be swapped without a reload.
+func (r *reloader) notify(path string) {
+	r.notifyGroup(path, "")
+}
+
+// notifyGroup is like notify, for a change to a file in a -watch-group.
+// Pages of other groups ignore the reload.
+func (r *reloader) notifyGroup(path, group string) {
+	msg := "reload"
+
+	if group != "" {
+		msg += "@" + group
+	}
+
+	if path != "" {
+		msg += ":" + path
+	}
+
+	r.mu.Lock()
+	r.lastErr = ""
+
+	// Within -min-interval of the last reload only the final one is kept, and
+	// a full reload is sent instead if the dropped ones differ from it.
+	if wait := r.minInterval - time.Since(r.sent); r.queued != "" || wait > 0 {
+		switch r.queued {
+		case "":
+			time.AfterFunc(wait, r.sendQueued)
+			r.queued = msg
+		case msg:
+		default:
+			r.queued = "reload"
+		}
+
+		r.mu.Unlock()
+
+		return
+	}
+
+	r.sent = time.Now()
+	r.reloads++
+	r.mu.Unlock()
+
+	r.broadcast(msg)
+}
+
+func (r *reloader) sendQueued() {
+	r.mu.Lock()
+	msg := r.queued
+	r.queued = ""
+
+	if msg == "" {
+		r.mu.Unlock()
+
+		return
+	}
+
+	r.sent = time.Now()
+	r.reloads++
+	r.mu.Unlock()
+
+	r.broadcast(msg)
+}
+
+// hardReload tells all clients to reload the page right away, returning the
+// number of clients told.
+func (r *reloader) hardReload() int {
+	r.mu.Lock()
+	r.lastErr = ""
+	r.sent = time.Now()
+	r.reloads++
+	n := len(r.clients)
+	r.mu.Unlock()
+
+	r.broadcast("full")
+
+	return n
+}
+
+// fail keeps the build error so that clients connecting later are shown it
+// as well, until the next successful reload.
+func (r *reloader) fail(stderr string) {
+	r.mu.Lock()
+	r.lastErr = stderr
+	r.queued = ""
+	r.mu.Unlock()
+
+	r.broadcast(errorMessage(stderr))
+}
+
+func errorMessage(stderr string) string {
+	return "error:" + base64.StdEncoding.EncodeToString([]byte(stderr))
+}
+
+func (r *reloader) broadcast(msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.log.Debug(fmt.Sprintf("⟳ %s (%d clients)", msg, len(r.clients)), "event", "broadcast", "message", msg, "clients", len(r.clients))
+
+	for ch := range r.clients {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// reloadScript is injected into served HTML pages, connecting to the reload
+// stream at ReloadPath, and falling back to a WebSocket if that fails. Once
+// the connection is lost an indicator is shown, and the page is reloaded when
+// the server is back.
+// With WasmBust, fetch is patched to bypass the cache for .wasm files, and
+// with Sync, scrolling and clicks are relayed to the other clients. Reload
+// "full" always reloads the page, and "soft" only ever swaps stylesheets.
+// Reloads for a -watch-group are ignored by pages with another data-live-group.
+const reloadScript = `<script>
+{{if .WasmBust}}if(window.fetch){const o=window.fetch;window.fetch=(a,...r)=>{if(typeof a==="string"||a instanceof URL){const u=new URL(a,location.href);if(/\.wasm$/i.test(u.pathname)){u.searchParams.set("_",Date.now());a=u.href}}return o(a,...r)}};{{end}}const h=(d)=>{const i=d.indexOf(":"),[t,g=""]=(i<0?d:d.slice(0,i)).split("@"),x=i<0?"":d.slice(i+1),k={{if eq .Reload "full"}}""{{else}}t==="full"?"":(x.match(/\.[^./]*$/)||[""])[0].toLowerCase(){{end}};if(t==="error"){let d=document.getElementById("__live_error");if(!d){d=document.createElement("div");d.id="__live_error";d.style.cssText="position:fixed;inset:0;z-index:2147483647;margin:0;padding:2em;overflow:auto;background:rgba(0,0,0,.9);color:#f66;font:14px/1.5 monospace;white-space:pre-wrap";(document.body||document.documentElement).appendChild(d)}d.textContent=new TextDecoder().decode(Uint8Array.from(atob(x),c=>c.charCodeAt(0)));return}{{if .Sync}}if(t==="sync"){const m=JSON.parse(x),r=document.documentElement;if(m.id===id||m.path!==location.pathname)return;if(m.type==="scroll"){const X=m.x*(r.scrollWidth-innerWidth),Y=m.y*(r.scrollHeight-innerHeight);if(Math.abs(scrollX-X)+Math.abs(scrollY-Y)>1){q=1;scrollTo(X,Y)}}else document.querySelector(m.selector)?.click();return}{{end}}if(t!=="reload"&&t!=="full")return;if(g&&(document.documentElement.dataset.liveGroup||g)!==g)return;console.log("[live] reload"+(x?" "+x:""));const n=Date.now(),b=u=>u.split("?")[0]+"?_="+n;if(k===".css"){document.getElementById("__live_error")?.remove();document.querySelectorAll("link[rel=stylesheet]").forEach(el=>el.href=b(el.href));return}if(/^\.(png|jpe?g|gif|svg|webp|avif|ico)$/.test(k)){document.getElementById("__live_error")?.remove();const m=u=>new URL(u,location.href).pathname===x;document.querySelectorAll("img[src]").forEach(el=>{if(m(el.src))el.src=b(el.src)});document.querySelectorAll("*").forEach(el=>{const v=getComputedStyle(el).backgroundImage;if(v.includes(x))el.style.backgroundImage=v.replace(/url\("?([^")]+)"?\)/g,(s,u)=>m(u)?'url("'+b(u)+'")':s)});return}{{if eq .Reload "soft"}}if(t!=="full"){document.getElementById("__live_error")?.remove();document.querySelectorAll("link[rel=stylesheet]").forEach(el=>el.href=b(el.href));return}{{end}}document.querySelectorAll("script[src], link[rel=stylesheet]").forEach(el=>{if(el.src)el.src=b(el.src);if(el.href)el.href=b(el.href)}),sessionStorage.setItem("__live_scroll",JSON.stringify([location.pathname,scrollX,scrollY])),location.reload()};{const s=sessionStorage.getItem("__live_scroll");if(s){sessionStorage.removeItem("__live_scroll");const[p,x,y]=JSON.parse(s);if(p===location.pathname)addEventListener("load",()=>scrollTo(x,y))}};let c=!1,l=!1;const L={{if .ReloadPort}}location.protocol+"//"+location.hostname+":{{.ReloadPort}}"{{else}}location.origin{{end}},u=L+"{{.ReloadPath}}";const st=()=>{if(document.getElementById("__live_status"))return;const d=document.createElement("div");d.id="__live_status";d.textContent="disconnected \u2014 reconnecting\u2026";d.style.cssText="position:fixed;right:8px;bottom:8px;z-index:2147483647;padding:2px 8px;border-radius:4px;background:rgba(0,0,0,.7);color:#fff;font:12px/1.5 system-ui,sans-serif;pointer-events:none";(document.body||document.documentElement).appendChild(d)},o=()=>{if(l)return h("reload");c=!0},x=()=>{if(c){l=!0;st()}};const e=new EventSource(u);e.onopen=o;e.onerror=x;e.onmessage=(ev)=>h(ev.data);const ws=()=>{const w=new WebSocket(u.replace(/^http/,"ws")+"/ws");w.onopen=o;w.onmessage=(ev)=>h(ev.data);w.onclose=()=>{x();setTimeout(ws,1e3)}};setTimeout(()=>{if(c)return;e.close();ws()},3e3);{{if .Sync}}const id=Math.random().toString(36).slice(2),p=(m)=>fetch(L+"{{.LivePath}}/sync",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({id,path:location.pathname,...m}),keepalive:!0}).catch(()=>{});let q=0,tm=0;addEventListener("scroll",()=>{if(q){q=0;return}if(tm)return;tm=setTimeout(()=>{tm=0;const r=document.documentElement;p({type:"scroll",x:scrollX/Math.max(1,r.scrollWidth-innerWidth),y:scrollY/Math.max(1,r.scrollHeight-innerHeight)})},50)},{passive:!0});addEventListener("click",(ev)=>{if(!ev.isTrusted)return;const s=[];for(let el=ev.target;el&&el.parentElement;el=el.parentElement)s.unshift(el.tagName.toLowerCase()+":nth-child("+([...el.parentElement.children].indexOf(el)+1)+")");if(s.length)p({type:"click",selector:s.join(">")})},!0);{{end}}</script>`
+
+// reloadMarker precedes the injected snippet, so that pages which already
+// contain it are not injected twice.
+const reloadMarker = "<!--live-reload-->"
+
+var reloadTemplate = template.Must(template.New("reload").Parse(reloadScript))
+
+type snippetData struct {
+	ReloadPath string
+	LivePath   string
+	WasmBust   bool
+	Sync       bool
+	Reload     string
+	ReloadPort int
+}
+
+// renderSnippet executes the reload script, or the -snippet file if given,
+// surrounded by reloadMarker comments.
+func renderSnippet(cfg Config) ([]byte, error) {
+	tmpl := reloadTemplate
+
+	if cfg.snippetFile != "" {
+		data, err := os.ReadFile(cfg.snippetFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if tmpl, err = template.New("snippet").Parse(string(data)); err != nil {
+			return nil, err
+		}
+	}
+
+	// The endpoints on -reload-port are not served under -base.
+	base := cfg.base
+
+	if cfg.reloadPort > 0 {
+		base = ""
+	}
+
+	buf := bytes.NewBufferString(reloadMarker)
+
+	if err := tmpl.Execute(buf, snippetData{
+		ReloadPath: base + cfg.reloadPath,
+		LivePath:   base + livePath,
+		WasmBust:   cfg.wasmBust,
+		Sync:       cfg.sync,
+		Reload:     cfg.reload,
+		ReloadPort: cfg.reloadPort,
+	}); err != nil {
+		return nil, err
+	}
+
+	buf.WriteString("<!--/live-reload-->")
+
+	return buf.Bytes(), nil
+}
+
+// injectReload inserts the reload script right after the <head> open tag,
+// before </body> if there is no head, or at the end of the document.
+// With inject set to body, it is inserted before </body> when possible.
+func injectReload(html, snippet []byte, inject string) []byte {
+	if bytes.Contains(html, []byte(reloadMarker)) {
+		return html
+	}
+
+	if inject == "body" {
+		if loc := bodyCloseTag.FindIndex(html); loc != nil {
+			return insertAt(html, loc[0], snippet)
+		}
+	}
+
+	if loc := headTag.FindIndex(html); loc != nil {
+		return insertAt(html, loc[1], snippet)
+	}
+
+	if loc := bodyCloseTag.FindIndex(html); loc != nil {
+		return insertAt(html, loc[0], snippet)
+	}
+
+	return append(html, snippet...)
+}
+
+var (
+	headTag      = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+	bodyCloseTag = regexp.MustCompile(`(?i)</body\s*>`)
+)
+
+func insertAt(html []byte, i int, snippet []byte) []byte {
+	out := make([]byte, 0, len(html)+len(snippet))
+	out = append(out, html[:i]...)
+	out = append(out, snippet...)
+
+	return append(out, html[i:]...)
+}
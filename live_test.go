@@ -0,0 +1,891 @@
+package live
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// writeFiles writes files, keyed by slash-separated name, to a temporary
+// directory and returns its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+// testConfig returns the Config of args for a root with files.
+func testConfig(t *testing.T, files map[string]string, args ...string) Config {
+	t.Helper()
+
+	cfg, err := Parse(append([]string{"live", "-open=false", "-quiet", "-root", writeFiles(t, files)}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+// newTestServer returns a Server for a root with files, configured by args.
+func newTestServer(t *testing.T, files map[string]string, args ...string) *Server {
+	t.Helper()
+
+	return New(testConfig(t, files, args...))
+}
+
+// received returns the messages sent to ch within d.
+func received[T any](ch chan T, d time.Duration) []T {
+	var msgs []T
+
+	timeout := time.After(d)
+
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return msgs
+			}
+
+			msgs = append(msgs, msg)
+		case <-timeout:
+			return msgs
+		}
+	}
+}
+
+// get requests target from h, with headers given as name, value pairs.
+func get(h http.Handler, target string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestNewConfig(t *testing.T) {
+	root := writeFiles(t, map[string]string{"index.html": "<html><head></head></html>"})
+
+	cfg, err := NewConfig(Root(root), Addr("127.0.0.1:0"), Wait(20*time.Millisecond), NoBrowser())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.root != root || cfg.addr != "127.0.0.1:0" || cfg.wait != 20*time.Millisecond || cfg.open {
+		t.Errorf("NewConfig did not apply the options: %+v", cfg)
+	}
+
+	if rec := get(New(cfg), "/"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<script") {
+		t.Errorf("GET / = %d %q, want the page with the reload script", rec.Code, rec.Body)
+	}
+
+	// Invalid flags are returned as errors instead of exiting.
+	for _, flag := range [][2]string{{"no-such-flag", "1"}, {"open", "maybe"}, {"wait", "soon"}} {
+		if _, err := NewConfig(Flag(flag[0], flag[1])); err == nil {
+			t.Errorf("NewConfig with -%s=%s: want an error", flag[0], flag[1])
+		}
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"index.html": ""})
+
+	r := newReloader(cfg, newLogger(cfg))
+	ws := newWatchState(cfg, newLogger(cfg))
+
+	ch, _ := r.add()
+	path := filepath.Join(cfg.root, "index.html")
+
+	for i := range 10 {
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", i+1)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		ws.trigger(path, 50*time.Millisecond, r)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if msgs := received(ch, 300*time.Millisecond); len(msgs) != 1 {
+		t.Errorf("got %d reloads, want one", len(msgs))
+	}
+
+	// Events for unchanged files are dropped.
+	ws.trigger(path, 50*time.Millisecond, r)
+
+	if msgs := received(ch, 150*time.Millisecond); len(msgs) != 0 {
+		t.Errorf("got %d reloads for an unchanged file, want none", len(msgs))
+	}
+}
+
+func TestStreamRemovesClient(t *testing.T) {
+	cfg := testConfig(t, nil)
+	r := newReloader(cfg, newLogger(cfg))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/__livereload", nil)
+
+	done := make(chan struct{})
+
+	go func() {
+		r.endpoint(httptest.NewRecorder(), req)
+		close(done)
+	}()
+
+	for r.clientCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the stream is still open after the request was canceled")
+	}
+
+	if n := r.clientCount(); n != 0 {
+		t.Errorf("%d clients after the request was canceled, want 0", n)
+	}
+}
+
+func TestForget(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"a.html": "", "dir/b.html": "", "dir/c.html": "", "dir2/d.html": ""})
+	ws := newWatchState(cfg, newLogger(cfg))
+
+	for _, name := range []string{"a.html", "dir/b.html", "dir/c.html", "dir2/d.html"} {
+		ws.record(filepath.Join(cfg.root, filepath.FromSlash(name)))
+	}
+
+	if len(ws.seen) != 4 {
+		t.Fatalf("seen %d files, want 4", len(ws.seen))
+	}
+
+	path := filepath.Join(cfg.root, "a.html")
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ws.forget(path)
+
+	if _, ok := ws.seen[path]; ok || len(ws.seen) != 3 {
+		t.Errorf("seen %d files after a removal, want 3", len(ws.seen))
+	}
+
+	// Everything below a directory is forgotten along with it.
+	ws.forget(filepath.Join(cfg.root, "dir"))
+
+	if len(ws.seen) != 1 {
+		t.Errorf("seen %d files after removing a directory, want 1", len(ws.seen))
+	}
+}
+
+// startWatch watches the roots of cfg until the test ends, returning the
+// channel of a client of its reloader.
+func startWatch(t *testing.T, cfg Config) chan string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	log := newLogger(cfg)
+	r := newReloader(cfg, log)
+
+	if err := watch(ctx, cfg, &hotConfig{cfg: cfg, rewatch: make(chan struct{}, 1)}, r, log); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, _ := r.add()
+
+	return ch
+}
+
+func TestBroadcast(t *testing.T) {
+	cfg := testConfig(t, nil)
+	r := newReloader(cfg, newLogger(cfg))
+
+	var clients []chan string
+
+	for range 5 {
+		ch, ok := r.add()
+		if !ok {
+			t.Fatal("client refused")
+		}
+
+		clients = append(clients, ch)
+	}
+
+	r.notify("/style.css")
+
+	for i, ch := range clients {
+		if msgs := received(ch, 50*time.Millisecond); len(msgs) != 1 || msgs[0] != "reload:/style.css" {
+			t.Errorf("client %d got %q, want a single reload", i, msgs)
+		}
+	}
+
+	r.remove(clients[0])
+
+	if n := r.clientCount(); n != 4 {
+		t.Errorf("%d clients, want 4", n)
+	}
+}
+
+func TestAtomicSave(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"index.html": "old"}, "-wait", "50ms")
+	ch := startWatch(t, cfg)
+
+	tmp := filepath.Join(cfg.root, ".index.html.tmp")
+
+	if err := os.WriteFile(tmp, []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(tmp, filepath.Join(cfg.root, "index.html")); err != nil {
+		t.Fatal(err)
+	}
+
+	if msgs := received(ch, 500*time.Millisecond); len(msgs) != 1 || msgs[0] != "reload:/index.html" {
+		t.Errorf("got %q, want a single reload", msgs)
+	}
+}
+
+func TestServeWithinRoot(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"secret.html":      "<html><body>secret</body></html>",
+		"outside/a.html":   "<html><body>secret</body></html>",
+		"site/index.html":  "<html><body>index</body></html>",
+		"site/sub/b.html":  "<html><body>b</body></html>",
+		"site/inside.html": "<html><body>inside</body></html>",
+	})
+	root := filepath.Join(dir, "site")
+
+	for name, target := range map[string]string{
+		"link.html":   "../secret.html",
+		"linked":      "../outside",
+		"inside-link": "inside.html",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	for _, follow := range []bool{false, true} {
+		args := []string{"live", "-quiet", "-root", root}
+		if follow {
+			args = append(args, "-follow-symlinks")
+		}
+
+		cfg, err := Parse(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := New(cfg)
+
+		for _, tt := range []struct {
+			target string
+			want   int
+		}{
+			{"/index.html", http.StatusOK},
+			{"/sub/b.html", http.StatusOK},
+			{"/inside-link", http.StatusOK},
+			{"/..%2fsecret.html", http.StatusNotFound},
+			{"/sub/..%2f..%2fsecret.html", http.StatusNotFound},
+			{"/%2e%2e/secret.html", http.StatusNotFound},
+			{"/link.html", http.StatusNotFound},
+			{"/linked/a.html", http.StatusNotFound},
+		} {
+			// Symlinks are followed out of the root with -follow-symlinks.
+			want := tt.want
+			if follow && (tt.target == "/link.html" || tt.target == "/linked/a.html") {
+				want = http.StatusOK
+			}
+
+			rec := get(s, tt.target)
+
+			if rec.Code != want {
+				t.Errorf("-follow-symlinks=%v: GET %s = %d, want %d", follow, tt.target, rec.Code, want)
+			}
+
+			if want != http.StatusOK && strings.Contains(rec.Body.String(), "secret") {
+				t.Errorf("-follow-symlinks=%v: GET %s served a file outside of the root", follow, tt.target)
+			}
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	files := map[string]string{"app.wasm": "\x00asm", "README.md": "# x", "data.geojson": "{}", "style.css": "body{}"}
+
+	for _, tt := range []struct {
+		mime   string
+		target string
+		want   string
+	}{
+		{"", "/app.wasm", "application/wasm"},
+		{"", "/style.css", "text/css; charset=utf-8"},
+		{".md=text/plain", "/README.md", "text/plain"},
+		{"md=text/plain,.GeoJSON=application/geo+json", "/data.geojson", "application/geo+json"},
+		{".wasm=application/octet-stream", "/app.wasm", "application/octet-stream"},
+	} {
+		rec := get(newTestServer(t, files, "-mime", tt.mime), tt.target)
+
+		if got := rec.Header().Get("Content-Type"); got != tt.want {
+			t.Errorf("-mime %q: GET %s: Content-Type %q, want %q", tt.mime, tt.target, got, tt.want)
+		}
+	}
+
+	for _, mime := range []string{"md", "=text/plain", ".md="} {
+		if _, err := NewConfig(Flag("mime", mime)); err == nil {
+			t.Errorf("-mime %q: want an error", mime)
+		}
+	}
+}
+
+func TestWasmBust(t *testing.T) {
+	files := map[string]string{"index.html": "<html><head></head><body></body></html>"}
+
+	for _, tt := range []struct {
+		flag string
+		want bool
+	}{
+		{"-wasm-bust", true},
+		{"-wasm-bust=false", false},
+	} {
+		body := get(newTestServer(t, files, tt.flag), "/").Body.String()
+
+		if got := strings.Contains(body, "window.fetch"); got != tt.want {
+			t.Errorf("%s: fetch patched %v, want %v", tt.flag, got, tt.want)
+		}
+
+		if !strings.Contains(body, "new EventSource(") {
+			t.Errorf("%s: no EventSource in %q", tt.flag, body)
+		}
+	}
+}
+
+func TestInjectReload(t *testing.T) {
+	for _, tt := range []struct {
+		html   string
+		inject string
+		want   string
+	}{
+		{"<html><head><title>x</title></head><body></body></html>", "head", "<html><head>@<title>x</title></head><body></body></html>"},
+		{`<html><head class="x"></head></html>`, "head", `<html><head class="x">@</head></html>`},
+		{"<html><head\n  lang=en></head></html>", "head", "<html><head\n  lang=en>@</head></html>"},
+		{"<HTML><HEAD></HEAD></HTML>", "head", "<HTML><HEAD>@</HEAD></HTML>"},
+		{"<header></header><body></body>", "head", "<header></header><body>@</body>"},
+		{"<p>no head</p></BODY >", "head", "<p>no head</p>@</BODY >"},
+		{"<p>no head", "head", "<p>no head@"},
+		{"<html><head></head><body></body></html>", "body", "<html><head></head><body>@</body></html>"},
+		{"<html><head></head><BODY></BODY></html>", "body", "<html><head></head><BODY>@</BODY></html>"},
+		{"<html><head></head></html>", "body", "<html><head>@</head></html>"},
+		{"<p>no body", "body", "<p>no body@"},
+		{"<head>" + reloadMarker + "</head>", "head", "<head>" + reloadMarker + "</head>"},
+		{"<body>" + reloadMarker + "</body>", "body", "<body>" + reloadMarker + "</body>"},
+	} {
+		if got := string(injectReload([]byte(tt.html), []byte("@"), tt.inject)); got != tt.want {
+			t.Errorf("injectReload(%q, %q) = %q, want %q", tt.html, tt.inject, got, tt.want)
+		}
+	}
+}
+
+func TestInjection(t *testing.T) {
+	files := map[string]string{
+		"index.html":   "<html><head><title>x</title></head><body>index</body></html>",
+		"no-body.html": "<p>no body",
+		"upper.html":   "<HTML><BODY>upper</BODY></HTML>",
+		"page.htm":     "<html><head></head><body></body></html>",
+		"data.json":    `{"html": "<head></head><body></body>"}`,
+		"notes.txt":    "<head></head><body></body>",
+		"style.css":    "body{}",
+		"app.js":       "document.body",
+		"image.svg":    "<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>",
+		"twice.html":   "<html><head>" + reloadMarker + "<script></script></head></html>",
+	}
+
+	s := newTestServer(t, files)
+
+	for _, tt := range []struct {
+		target string
+		want   int // injected scripts
+		before string
+	}{
+		{"/", 1, "<title>"},
+		{"/index.html", 1, "<title>"},
+		{"/no-body.html", 1, ""},
+		{"/upper.html", 1, "</BODY>"},
+		{"/page.htm", 1, "</head>"},
+		{"/data.json", 0, ""},
+		{"/notes.txt", 0, ""},
+		{"/style.css", 0, ""},
+		{"/app.js", 0, ""},
+		{"/image.svg", 0, ""},
+		{"/twice.html", 1, "</head>"},
+	} {
+		rec := get(s, tt.target)
+		body := rec.Body.String()
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", tt.target, rec.Code)
+
+			continue
+		}
+
+		if n := strings.Count(body, "<script"); n != tt.want {
+			t.Errorf("GET %s injected %d times, want %d", tt.target, n, tt.want)
+		}
+
+		if tt.want > 0 && !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("GET %s injected into %q", tt.target, rec.Header().Get("Content-Type"))
+		}
+
+		if tt.before != "" && strings.Index(body, "<script") > strings.Index(body, tt.before) {
+			t.Errorf("GET %s injected after %s: %q", tt.target, tt.before, body)
+		}
+
+		if tt.before == "" && tt.want > 0 && !strings.HasPrefix(body, files[tt.target[1:]]) {
+			t.Errorf("GET %s not injected at the end: %q", tt.target, body)
+		}
+	}
+}
+
+func TestInjectPlacement(t *testing.T) {
+	files := map[string]string{
+		"index.html": "<html><head><title>x</title></head><body>index</body></html>",
+	}
+
+	for _, tt := range []struct {
+		inject string
+		before string
+	}{
+		{"head", "<title>"},
+		{"body", "</body>"},
+	} {
+		body := get(newTestServer(t, files, "-inject", tt.inject), "/").Body.String()
+
+		if at := strings.Index(body, "<script"); at < 0 || at > strings.Index(body, tt.before) {
+			t.Errorf("-inject %s: script not before %s: %q", tt.inject, tt.before, body)
+		}
+
+		if tt.inject == "body" && strings.Index(body, "<script") < strings.Index(body, "index") {
+			t.Errorf("-inject body: script before the body content: %q", body)
+		}
+	}
+
+	if _, err := NewConfig(Flag("inject", "footer")); err == nil {
+		t.Error("NewConfig(-inject footer) succeeded, want an error")
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	files := map[string]string{"index.html": "<html></html>", "style.css": "body{}"}
+
+	for _, tt := range []struct {
+		args   []string
+		target string
+		want   string
+	}{
+		{nil, "/style.css", ""},
+		{nil, "/index.html", "no-cache"},
+		{[]string{"-cache-control", "public, max-age=3600"}, "/style.css", "public, max-age=3600"},
+		{[]string{"-cache-control", "public, max-age=3600"}, "/index.html", "no-cache"},
+		{[]string{"-cache-control", "public, max-age=3600"}, "/", "no-cache"},
+	} {
+		rec := get(newTestServer(t, files, tt.args...), tt.target)
+
+		if got := rec.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%q: GET %s: Cache-Control %q, want %q", tt.args, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCleanURLs(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"index.html":      "<html><body>index</body></html>",
+		"about.html":      "<html><body>about</body></html>",
+		"docs/index.html": "<html><body>docs</body></html>",
+		"docs/guide.html": "<html><body>guide</body></html>",
+		"blog/index.html": "<html><body>blog</body></html>",
+		"blog.html":       "<html><body>blog page</body></html>",
+		"style.css":       "body{}",
+	}, "-clean-urls")
+
+	for _, tt := range []struct {
+		target   string
+		code     int
+		location string
+		body     string
+	}{
+		{"/about", http.StatusOK, "", "about"},
+		{"/docs/guide", http.StatusOK, "", "guide"},
+		{"/docs/", http.StatusOK, "", "docs"},
+		{"/blog/", http.StatusOK, "", "blog"},
+		{"/about.html", http.StatusMovedPermanently, "about", ""},
+		{"/about.html?x=1", http.StatusMovedPermanently, "about?x=1", ""},
+		{"/docs/guide.html", http.StatusMovedPermanently, "guide", ""},
+		{"/docs/index.html", http.StatusMovedPermanently, "./", ""},
+		{"/missing.html", http.StatusNotFound, "", ""},
+		{"/missing", http.StatusNotFound, "", ""},
+		{"/style.css", http.StatusOK, "", "body{}"},
+	} {
+		rec := get(s, tt.target)
+
+		if rec.Code != tt.code {
+			t.Errorf("GET %s = %d, want %d", tt.target, rec.Code, tt.code)
+		}
+
+		if got := rec.Header().Get("Location"); got != tt.location {
+			t.Errorf("GET %s: Location %q, want %q", tt.target, got, tt.location)
+		}
+
+		if !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("GET %s: body %q, want %q", tt.target, rec.Body, tt.body)
+		}
+
+		if strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") && tt.code == http.StatusOK &&
+			!strings.Contains(rec.Body.String(), reloadMarker) {
+			t.Errorf("GET %s: not injected", tt.target)
+		}
+	}
+}
+
+func TestRenamedDirectory(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"index.html": "", "sub/a.css": "a"}, "-wait", "20ms")
+	ch := startWatch(t, cfg)
+
+	if err := os.Rename(filepath.Join(cfg.root, "sub"), filepath.Join(cfg.root, "renamed")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Whatever the rename itself triggers.
+	received(ch, 200*time.Millisecond)
+
+	if err := os.WriteFile(filepath.Join(cfg.root, "renamed", "a.css"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if msgs := received(ch, 300*time.Millisecond); len(msgs) != 1 || msgs[0] != "reload:/renamed/a.css" {
+		t.Errorf("got %q after a change in the renamed directory, want a reload", msgs)
+	}
+
+	// A directory created where one was removed is watched as well.
+	if err := os.Mkdir(filepath.Join(cfg.root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if err := os.WriteFile(filepath.Join(cfg.root, "sub", "b.css"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if msgs := received(ch, 300*time.Millisecond); len(msgs) != 1 || msgs[0] != "reload:/sub/b.css" {
+		t.Errorf("got %q after a change in the recreated directory, want a reload", msgs)
+	}
+}
+
+func TestNewFS(t *testing.T) {
+	cfg, err := NewConfig(Root(t.TempDir()), Flag("clean-urls", "true"), Flag("quiet", "true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewFS(cfg, fstest.MapFS{
+		"index.html":      {Data: []byte("<html><head></head><body>embedded</body></html>")},
+		"about.html":      {Data: []byte("<html><head></head><body>about</body></html>")},
+		"static/app.wasm": {Data: []byte("\x00asm")},
+	})
+
+	for _, tt := range []struct {
+		target string
+		code   int
+		body   string
+		ctype  string
+	}{
+		{"/", http.StatusOK, "embedded", "text/html"},
+		{"/about", http.StatusOK, "about", "text/html"},
+		{"/static/app.wasm", http.StatusOK, "\x00asm", "application/wasm"},
+		{"/missing.html", http.StatusNotFound, "", "text/plain; charset=utf-8"},
+	} {
+		rec := get(s, tt.target)
+
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.body) || rec.Header().Get("Content-Type") != tt.ctype {
+			t.Errorf("GET %s = %d %q %q, want %d %q %q", tt.target, rec.Code, rec.Header().Get("Content-Type"), rec.Body, tt.code, tt.ctype, tt.body)
+		}
+
+		if tt.ctype == "text/html" && !strings.Contains(rec.Body.String(), reloadMarker) {
+			t.Errorf("GET %s: not injected", tt.target)
+		}
+	}
+}
+
+func TestServeHTMLRanges(t *testing.T) {
+	s := newTestServer(t, map[string]string{"index.html": "<html><head></head><body>hello</body></html>"})
+
+	page := get(s, "/index.html").Body.String()
+
+	rec := get(s, "/index.html", "Range", "bytes=0-5")
+
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != page[:6] {
+		t.Errorf("GET with a Range = %d %q, want 206 %q", rec.Code, rec.Body, page[:6])
+	}
+
+	if got, want := rec.Header().Get("Content-Range"), fmt.Sprintf("bytes 0-5/%d", len(page)); got != want {
+		t.Errorf("Content-Range %q, want %q", got, want)
+	}
+
+	etag := get(s, "/index.html").Header().Get("ETag")
+
+	if rec := get(s, "/index.html", "If-None-Match", etag); etag == "" || rec.Code != http.StatusNotModified {
+		t.Errorf("GET with If-None-Match %q = %d, want 304", etag, rec.Code)
+	}
+
+	if rec := get(s, "/index.html", "Range", "bytes=1000000-"); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("GET with an unsatisfiable Range = %d, want 416", rec.Code)
+	}
+}
+
+func TestStreamConnected(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL + "/__livereload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type %q, want text/event-stream", got)
+	}
+
+	// Only what was flushed on connect can be read.
+	buf := make([]byte, 256)
+
+	n, err := res.Body.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(buf[:n]); !strings.Contains(got, ": connected\n\n") || !strings.HasPrefix(got, "retry: ") {
+		t.Errorf("first chunk %q, want the retry directive and a comment", got)
+	}
+}
+
+// readEvent reads the next event, or comment, of a reload stream.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	var lines []string
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line == "\n" {
+			return strings.Join(lines, "\n")
+		}
+
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+}
+
+func TestStreamHTTP2(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	srv := httptest.NewUnstartedServer(s)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL + "/__livereload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.ProtoMajor != 2 {
+		t.Fatalf("served over %s, want HTTP/2", res.Proto)
+	}
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Connection") != "" {
+		t.Errorf("status %d with Connection %q, want 200 without a Connection header", res.StatusCode, res.Header.Get("Connection"))
+	}
+
+	r := bufio.NewReader(res.Body)
+
+	if got := readEvent(t, r); !strings.HasSuffix(got, ": connected") {
+		t.Errorf("first event %q, want a comment", got)
+	}
+
+	s.reloader.notify("/style.css")
+
+	if got := readEvent(t, r); got != "data: reload:/style.css" {
+		t.Errorf("event %q, want a reload", got)
+	}
+}
+
+func TestNoDotfiles(t *testing.T) {
+	files := map[string]string{
+		".env":          "SECRET=1",
+		".git/config":   "[core]",
+		"sub/.secret":   "secret",
+		"sub/page.html": "<html></html>",
+		"a.b.txt":       "dots",
+	}
+
+	s := newTestServer(t, files, "-no-dotfiles")
+
+	for _, tt := range []struct {
+		target string
+		want   int
+	}{
+		{"/.env", http.StatusNotFound},
+		{"/.git/config", http.StatusNotFound},
+		{"/.git/", http.StatusNotFound},
+		{"/sub/.secret", http.StatusNotFound},
+		{"/sub/%2esecret", http.StatusNotFound},
+		{"/sub/page.html", http.StatusOK},
+		{"/a.b.txt", http.StatusOK},
+	} {
+		if rec := get(s, tt.target); rec.Code != tt.want {
+			t.Errorf("-no-dotfiles: GET %s = %d, want %d", tt.target, rec.Code, tt.want)
+		}
+	}
+
+	if rec := get(newTestServer(t, files), "/.env"); rec.Code != http.StatusOK {
+		t.Errorf("GET /.env = %d, want 200 without -no-dotfiles", rec.Code)
+	}
+
+	rec := get(newTestServer(t, files, "-no-dotfiles", "-listing"), "/sub/")
+
+	if strings.Contains(rec.Body.String(), ".secret") || !strings.Contains(rec.Body.String(), "page.html") {
+		t.Errorf("-no-dotfiles: listing %q, want dotfiles left out", rec.Body)
+	}
+}
+
+func TestMountRedirect(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"index.html": "<html><body>mounted</body></html>"})
+
+	for _, base := range []string{"", "/app"} {
+		s := newTestServer(t, map[string]string{"index.html": "<html></html>"}, "-base", base, "-mount", "/assets/m="+dir)
+
+		for _, target := range []string{base + "/assets/m", base + "/assets/m?x=1"} {
+			rec := get(s, target)
+
+			if rec.Code != http.StatusMovedPermanently {
+				t.Errorf("GET %s = %d, want 301", target, rec.Code)
+
+				continue
+			}
+
+			u, err := url.Parse(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loc, err := u.Parse(rec.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := base + "/assets/m/"; loc.Path != want || loc.RawQuery != u.RawQuery {
+				t.Errorf("GET %s redirected to %s, want %s", target, loc, want)
+			}
+
+			if rec := get(s, loc.String()); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "mounted") {
+				t.Errorf("GET %s = %d %q, want the mounted index", loc, rec.Code, rec.Body)
+			}
+		}
+	}
+}
+
+func TestWasmExec(t *testing.T) {
+	goroot, err := wasmExecPath()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	want, err := os.ReadFile(goroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		files  map[string]string
+		args   []string
+		target string
+		code   int
+		body   string
+	}{
+		{nil, nil, "/wasm_exec.js", http.StatusOK, string(want)},
+		{map[string]string{"wasm_exec.js": "// own"}, nil, "/wasm_exec.js", http.StatusOK, "// own"},
+		{nil, []string{"-wasm-exec=false"}, "/wasm_exec.js", http.StatusNotFound, ""},
+		{nil, nil, "/sub/wasm_exec.js", http.StatusNotFound, ""},
+	} {
+		rec := get(newTestServer(t, tt.files, tt.args...), tt.target)
+
+		if rec.Code != tt.code || (tt.body != "" && rec.Body.String() != tt.body) {
+			t.Errorf("%q: GET %s = %d with %d bytes, want %d with %d", tt.args, tt.target, rec.Code, rec.Body.Len(), tt.code, len(tt.body))
+		}
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	cfg := testConfig(t, nil)
+	r := newReloader(cfg, newLogger(cfg))
+
+	ch, _ := r.add()
+
+	for _, tt := range []struct {
+		body string
+		want string
+	}{
+		{`{"path":"/style.css"}`, "reload:/style.css"},
+		{`{"path":"style.css"}`, "reload:/style.css"},
+		{"", "reload"},
+	} {
+		rec := httptest.NewRecorder()
+		r.trigger(rec, httptest.NewRequest(http.MethodPost, "/__livereload/trigger", strings.NewReader(tt.body)))
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("POST %q = %d, want 204", tt.body, rec.Code)
+		}
+
+		if msgs := received(ch, 50*time.Millisecond); len(msgs) != 1 || msgs[0] != tt.want {
+			t.Errorf("POST %q sent %q, want %q", tt.body, msgs, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package live
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// newLogger logs errors, the startup banner unless quiet, and details about
+// events, clients and reloads when verbose. Messages are printed as is, or
+// as JSON objects together with their attributes when using -log json.
+func newLogger(cfg Config) *slog.Logger {
+	level := slog.LevelInfo
+
+	switch {
+	case cfg.quiet:
+		level = slog.LevelError
+	case cfg.verbose:
+		level = slog.LevelDebug
+	}
+
+	if cfg.log == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				switch a.Key {
+				case slog.TimeKey:
+					a.Key = "ts"
+				case slog.MessageKey:
+					a.Value = slog.StringValue(strings.TrimPrefix(a.Value.String(), "⟳ "))
+				}
+
+				return a
+			},
+		}))
+	}
+
+	return slog.New(&textHandler{
+		mu:    &sync.Mutex{},
+		out:   os.Stdout,
+		level: level,
+	})
+}
+
+// textHandler prints the message of each record, followed by the error
+// attribute if there is one.
+type textHandler struct {
+	mu    *sync.Mutex
+	out   io.Writer
+	level slog.Level
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	line := r.Message
+
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "error" {
+			line += ": " + a.Value.String()
+
+			return false
+		}
+
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := io.WriteString(h.out, line+"\n")
+
+	return err
+}
+
+func (h *textHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *textHandler) WithGroup(string) slog.Handler { return h }
@@ -0,0 +1,271 @@
+package live
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A small Markdown renderer for previewing documentation, supporting headings,
+// paragraphs, lists, block quotes, code, rules, links, images and emphasis.
+// Lines starting with < are passed through as HTML.
+
+var markdownTemplate = template.Must(template.New("markdown").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>{{.Title}}</title>
+<style>
+body{font:16px/1.6 system-ui,sans-serif;max-width:46em;margin:2em auto;padding:0 1em;color:#222}
+pre,code{font:14px/1.4 ui-monospace,monospace;background:#f4f4f4;border-radius:3px}
+code{padding:.1em .3em}
+pre{padding:1em;overflow:auto}
+pre code{padding:0;background:none}
+blockquote{margin:0;padding:0 1em;border-left:.25em solid #ddd;color:#666}
+img{max-width:100%}
+a{color:#0366d6}
+hr{border:0;border-top:1px solid #ddd}
+</style>
+</head>
+<body>
+{{.Body}}
+</body>
+</html>
+`))
+
+var (
+	mdHeading    = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdRule       = regexp.MustCompile(`^ {0,3}(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	mdFence      = regexp.MustCompile("^ {0,3}(```|~~~)\\s*([^`\\s]*)")
+	mdListItem   = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	mdCodeSpan   = regexp.MustCompile("`([^`]+)`")
+	mdImage      = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)(?:\s+&#34;([^)]*)&#34;)?\)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)(?:\s+&#34;([^)]*)&#34;)?\)`)
+	mdStrong     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdEmphasis   = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+	mdAutolink   = regexp.MustCompile(`&lt;(https?://[^\s&]+)&gt;`)
+	mdCodeMarker = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// renderMarkdown renders src as a complete HTML page.
+func renderMarkdown(src []byte, title string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := markdownTemplate.Execute(&buf, struct {
+		Title string
+		Body  template.HTML
+	}{title, template.HTML(markdownBlocks(strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")))})
+
+	return buf.Bytes(), err
+}
+
+func markdownBlocks(lines []string) string {
+	var (
+		out  strings.Builder
+		para []string
+	)
+
+	flush := func() {
+		if len(para) > 0 {
+			out.WriteString("<p>" + markdownInline(strings.Join(para, "\n")) + "</p>\n")
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case mdFence.MatchString(line):
+			flush()
+
+			m := mdFence.FindStringSubmatch(line)
+
+			var code []string
+
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]); i++ {
+				code = append(code, lines[i])
+			}
+
+			class := ""
+			if m[2] != "" {
+				class = ` class="language-` + html.EscapeString(m[2]) + `"`
+			}
+
+			out.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case mdHeading.MatchString(line):
+			flush()
+
+			m := mdHeading.FindStringSubmatch(line)
+			tag := "h" + strconv.Itoa(len(m[1]))
+
+			out.WriteString("<" + tag + ">" + markdownInline(m[2]) + "</" + tag + ">\n")
+		case mdRule.MatchString(line):
+			flush()
+			out.WriteString("<hr>\n")
+		case strings.HasPrefix(strings.TrimLeft(line, " "), ">"):
+			flush()
+
+			var quote []string
+
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimLeft(lines[i], " "), ">"); i++ {
+				l := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				quote = append(quote, strings.TrimPrefix(l, " "))
+			}
+
+			i--
+
+			out.WriteString("<blockquote>\n" + markdownBlocks(quote) + "</blockquote>\n")
+		case mdListItem.MatchString(line) && (len(para) == 0 || !strings.HasPrefix(line, " ")):
+			flush()
+
+			i = markdownList(lines, i, &out) - 1
+		case strings.HasPrefix(line, "    ") && len(para) == 0:
+			var code []string
+
+			for ; i < len(lines) && (strings.HasPrefix(lines[i], "    ") || strings.TrimSpace(lines[i]) == ""); i++ {
+				code = append(code, strings.TrimPrefix(lines[i], "    "))
+			}
+
+			i--
+
+			out.WriteString("<pre><code>" + html.EscapeString(strings.TrimRight(strings.Join(code, "\n"), "\n")) + "</code></pre>\n")
+		case strings.HasPrefix(line, "<") && len(para) == 0:
+			out.WriteString(line + "\n")
+		default:
+			para = append(para, strings.TrimSpace(line))
+		}
+	}
+
+	flush()
+
+	return out.String()
+}
+
+// markdownList renders the list starting at lines[start], returning the index
+// of the first line after it. Lines indented past the marker belong to the
+// item, which allows nesting.
+func markdownList(lines []string, start int, out *strings.Builder) int {
+	first := mdListItem.FindStringSubmatch(lines[start])
+	ordered := first[2][0] >= '0' && first[2][0] <= '9'
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+
+	out.WriteString("<" + tag + ">\n")
+
+	// sameList reports if the matched item continues this list.
+	sameList := func(m []string) bool {
+		return m != nil && len(m[1]) <= len(first[1]) && (m[2][0] >= '0' && m[2][0] <= '9') == ordered
+	}
+
+	var (
+		items  [][]string
+		loose  bool
+		indent int
+		i      = start
+	)
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := mdListItem.FindStringSubmatch(line); m != nil && len(m[1]) <= len(first[1]) {
+			if !sameList(m) {
+				break
+			}
+
+			indent = len(m[1]) + len(m[2]) + 1
+			items = append(items, []string{m[3]})
+
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			// A blank line only continues the list if more of it follows.
+			if i+1 < len(lines) && (strings.HasPrefix(lines[i+1], strings.Repeat(" ", indent)) || sameList(mdListItem.FindStringSubmatch(lines[i+1]))) {
+				loose = true
+				items[len(items)-1] = append(items[len(items)-1], "")
+
+				continue
+			}
+
+			break
+		}
+
+		if !strings.HasPrefix(line, " ") && loose {
+			break
+		}
+
+		items[len(items)-1] = append(items[len(items)-1], strings.TrimPrefix(line, strings.Repeat(" ", min(indent, len(line)-len(strings.TrimLeft(line, " "))))))
+	}
+
+	for _, item := range items {
+		body := markdownBlocks(item)
+
+		if !loose {
+			// Tight lists do not wrap their text in paragraphs.
+			body = strings.TrimSuffix(strings.TrimPrefix(body, "<p>"), "</p>\n")
+			body = strings.Replace(body, "</p>\n", "\n", 1)
+		}
+
+		out.WriteString("<li>" + strings.TrimSuffix(body, "\n") + "</li>\n")
+	}
+
+	out.WriteString("</" + tag + ">\n")
+
+	return i
+}
+
+func markdownInline(text string) string {
+	// NUL delimits the code span markers, so it cannot be let through.
+	text = strings.ReplaceAll(text, "\x00", "\uFFFD")
+
+	// Code spans are set aside, so that their contents are left alone.
+	var spans []string
+
+	text = mdCodeSpan.ReplaceAllStringFunc(text, func(s string) string {
+		spans = append(spans, "<code>"+html.EscapeString(mdCodeSpan.FindStringSubmatch(s)[1])+"</code>")
+
+		return "\x00" + strconv.Itoa(len(spans)-1) + "\x00"
+	})
+
+	text = html.EscapeString(text)
+	text = mdImage.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdImage.FindStringSubmatch(s)
+
+		return `<img src="` + m[2] + `" alt="` + m[1] + `"` + titleAttr(m[3]) + `>`
+	})
+	text = mdLink.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdLink.FindStringSubmatch(s)
+
+		return `<a href="` + m[2] + `"` + titleAttr(m[3]) + `>` + m[1] + `</a>`
+	})
+	text = mdAutolink.ReplaceAllString(text, `<a href="$1">$1</a>`)
+	text = mdStrong.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = mdEmphasis.ReplaceAllString(text, "<em>$1$2</em>")
+
+	return mdCodeMarker.ReplaceAllStringFunc(text, func(s string) string {
+		n, err := strconv.Atoi(strings.Trim(s, "\x00"))
+		if err != nil || n >= len(spans) {
+			return s
+		}
+
+		return spans[n]
+	})
+}
+
+func titleAttr(title string) string {
+	if title == "" {
+		return ""
+	}
+
+	return ` title="` + title + `"`
+}
@@ -0,0 +1,22 @@
+package live
+
+import "testing"
+
+func TestMarkdownInline(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a `<b>` c", "a <code>&lt;b&gt;</code> c"},
+		{"**bold** and *em*", "<strong>bold</strong> and <em>em</em>"},
+		{"[x](/y)", `<a href="/y">x</a>`},
+		// NUL is not taken for the markers of the code spans.
+		{"\x007\x00", "�7�"},
+		{"`a` \x000\x00", "<code>a</code> �0�"},
+	} {
+		if got := markdownInline(tt.text); got != tt.want {
+			t.Errorf("markdownInline(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package live
+
+import (
+	"errors"
+	"strings"
+)
+
+// A minimal QR code encoder, supporting byte mode at error correction level M
+// for versions 1 through 10 (up to 213 bytes), which is plenty for a URL.
+
+var errQRTooLong = errors.New("qr: text too long")
+
+type qrVersion struct {
+	ecPerBlock int
+	blocks     []int // data codewords per block
+	alignment  []int
+}
+
+var qrVersions = []qrVersion{
+	{10, []int{16}, nil},
+	{16, []int{28}, []int{6, 18}},
+	{26, []int{44}, []int{6, 22}},
+	{18, []int{32, 32}, []int{6, 26}},
+	{24, []int{43, 43}, []int{6, 30}},
+	{16, []int{27, 27, 27, 27}, []int{6, 34}},
+	{18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	{22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	{22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	{26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// qrEncode returns the modules of a QR code encoding text, true being dark.
+func qrEncode(text string) ([][]bool, error) {
+	for i, v := range qrVersions {
+		version := i + 1
+
+		capacity := 0
+		for _, n := range v.blocks {
+			capacity += n
+		}
+
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+
+		if 4+countBits+8*len(text) > 8*capacity {
+			continue
+		}
+
+		data := qrData(text, countBits, capacity)
+
+		return qrBuild(version, v, qrInterleave(data, v)), nil
+	}
+
+	return nil, errQRTooLong
+}
+
+func qrData(text string, countBits, capacity int) []byte {
+	var bits []bool
+
+	appendBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1 == 1)
+		}
+	}
+
+	appendBits(0x4, 4)
+	appendBits(len(text), countBits)
+
+	for i := 0; i < len(text); i++ {
+		appendBits(int(text[i]), 8)
+	}
+
+	appendBits(0, min(4, 8*capacity-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+
+	data := make([]byte, 0, capacity)
+
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+
+		data = append(data, b)
+	}
+
+	for pad := byte(0xec); len(data) < capacity; pad ^= 0xec ^ 0x11 {
+		data = append(data, pad)
+	}
+
+	return data
+}
+
+func qrInterleave(data []byte, v qrVersion) []byte {
+	var (
+		blocks [][]byte
+		ecs    [][]byte
+		div    = rsDivisor(v.ecPerBlock)
+		most   = 0
+	)
+
+	for _, n := range v.blocks {
+		block := data[:n]
+		data = data[n:]
+
+		blocks = append(blocks, block)
+		ecs = append(ecs, rsRemainder(block, div))
+		most = max(most, n)
+	}
+
+	var out []byte
+
+	for i := 0; i < most; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, ec := range ecs {
+			out = append(out, ec[i])
+		}
+	}
+
+	return out
+}
+
+func qrBuild(version int, v qrVersion, codewords []byte) [][]bool {
+	size := 17 + 4*version
+
+	qr := &qrCode{
+		size:     size,
+		modules:  make([][]bool, size),
+		function: make([][]bool, size),
+	}
+
+	for y := range size {
+		qr.modules[y] = make([]bool, size)
+		qr.function[y] = make([]bool, size)
+	}
+
+	qr.drawFunctionPatterns(version, v.alignment)
+	qr.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+
+	for mask := range 8 {
+		qr.applyMask(mask)
+		qr.drawFormat(mask)
+
+		if p := qr.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+
+		qr.applyMask(mask)
+	}
+
+	qr.applyMask(best)
+	qr.drawFormat(best)
+
+	return qr.modules
+}
+
+func (qr *qrCode) set(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.function[y][x] = true
+}
+
+func (qr *qrCode) drawFunctionPatterns(version int, alignment []int) {
+	size := qr.size
+
+	for i := range size {
+		qr.set(6, i, i%2 == 0)
+		qr.set(i, 6, i%2 == 0)
+	}
+
+	qr.drawFinder(3, 3)
+	qr.drawFinder(size-4, 3)
+	qr.drawFinder(3, size-4)
+
+	n := len(alignment)
+
+	for i, x := range alignment {
+		for j, y := range alignment {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas, drawn for real once the mask is known.
+	qr.drawFormat(0)
+
+	if version >= 7 {
+		rem := version
+		for range 12 {
+			rem = rem<<1 ^ (rem>>11)*0x1f25
+		}
+
+		bits := version<<12 | rem
+
+		for i := range 18 {
+			dark := bits>>i&1 == 1
+			a, b := size-11+i%3, i/3
+
+			qr.set(a, b, dark)
+			qr.set(b, a, dark)
+		}
+	}
+}
+
+func (qr *qrCode) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+
+			if x < 0 || y < 0 || x >= qr.size || y >= qr.size {
+				continue
+			}
+
+			d := max(abs(dx), abs(dy))
+
+			qr.set(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+func (qr *qrCode) drawFormat(mask int) {
+	const levelM = 0
+
+	data := levelM<<3 | mask
+
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := range 6 {
+		qr.set(8, i, bit(i))
+	}
+
+	qr.set(8, 7, bit(6))
+	qr.set(8, 8, bit(7))
+	qr.set(7, 8, bit(8))
+
+	for i := 9; i < 15; i++ {
+		qr.set(14-i, 8, bit(i))
+	}
+
+	for i := range 8 {
+		qr.set(qr.size-1-i, 8, bit(i))
+	}
+
+	for i := 8; i < 15; i++ {
+		qr.set(8, qr.size-15+i, bit(i))
+	}
+
+	qr.set(8, qr.size-8, true)
+}
+
+func (qr *qrCode) drawCodewords(data []byte) {
+	i := 0
+
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+
+		for vert := range qr.size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert
+				}
+
+				if !qr.function[y][x] && i < len(data)*8 {
+					qr.modules[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (qr *qrCode) applyMask(mask int) {
+	for y := range qr.size {
+		for x := range qr.size {
+			if qr.function[y][x] {
+				continue
+			}
+
+			var invert bool
+
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+
+			qr.modules[y][x] = qr.modules[y][x] != invert
+		}
+	}
+}
+
+func (qr *qrCode) penalty() int {
+	var (
+		size    = qr.size
+		m       = qr.modules
+		penalty = 0
+		dark    = 0
+	)
+
+	line := func(get func(i int) bool) {
+		run := 1
+
+		for i := 1; i <= size; i++ {
+			if i < size && get(i) == get(i-1) {
+				run++
+
+				continue
+			}
+
+			if run >= 5 {
+				penalty += run - 2
+			}
+
+			run = 1
+		}
+
+		for i := 0; i+11 <= size; i++ {
+			var p [11]bool
+			for j := range p {
+				p[j] = get(i + j)
+			}
+
+			if p == [11]bool{true, false, true, true, true, false, true, false, false, false, false} ||
+				p == [11]bool{false, false, false, false, true, false, true, true, true, false, true} {
+				penalty += 40
+			}
+		}
+	}
+
+	for y := range size {
+		line(func(x int) bool { return m[y][x] })
+	}
+
+	for x := range size {
+		line(func(y int) bool { return m[y][x] })
+	}
+
+	for y := range size {
+		for x := range size {
+			if m[y][x] {
+				dark++
+			}
+
+			if x+1 < size && y+1 < size &&
+				m[y][x] == m[y][x+1] && m[y][x] == m[y+1][x] && m[y][x] == m[y+1][x+1] {
+				penalty += 3
+			}
+		}
+	}
+
+	return penalty + 10*(abs(dark*100/(size*size)-50)/5)
+}
+
+func rsMultiply(x, y byte) byte {
+	var z int
+
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+
+	return byte(z)
+}
+
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+
+	for range degree {
+		for j := range result {
+			result[j] = rsMultiply(result[j], root)
+
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+
+		root = rsMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+
+	for _, b := range data {
+		factor := b ^ result[0]
+
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+
+		for i := range result {
+			result[i] ^= rsMultiply(divisor[i], factor)
+		}
+	}
+
+	return result
+}
+
+// qrString renders the modules using Unicode half blocks, two rows per line,
+// with light modules drawn as blocks for terminals with a dark background.
+func qrString(modules [][]bool) string {
+	const quiet = 2
+
+	size := len(modules)
+
+	light := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+
+		if x < 0 || y < 0 || x >= size || y >= size {
+			return true
+		}
+
+		return !modules[y][x]
+	}
+
+	var sb strings.Builder
+
+	for y := 0; y < size+2*quiet; y += 2 {
+		for x := 0; x < size+2*quiet; x++ {
+			top, bottom := light(x, y), y+1 < size+2*quiet && light(x, y+1)
+
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
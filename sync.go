@@ -0,0 +1,100 @@
+package live
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// scrollInterval is the minimum duration between relayed scroll events.
+const scrollInterval = 50 * time.Millisecond
+
+// syncEvent is a scroll or click in one browser, to be mirrored by the others
+// showing the same path. Scroll positions are fractions of the page size.
+type syncEvent struct {
+	ID       string  `json:"id"`
+	Path     string  `json:"path"`
+	Type     string  `json:"type"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Selector string  `json:"selector,omitempty"`
+}
+
+// sync relays the events posted by clients with -sync to all clients, which
+// ignore their own.
+func (r *reloader) sync(w http.ResponseWriter, req *http.Request) {
+	var ev syncEvent
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 4096)).Decode(&ev); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if ev.Type != "scroll" && ev.Type != "click" {
+		http.Error(w, "unknown event type", http.StatusBadRequest)
+
+		return
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	msg := "sync:" + string(data)
+
+	if ev.Type == "scroll" {
+		r.scroll(msg)
+	} else {
+		r.relay(msg)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scroll relays at most one scroll event per scrollInterval, keeping the
+// latest one until then so that the final position is not lost.
+func (r *reloader) scroll(msg string) {
+	r.mu.Lock()
+
+	if wait := scrollInterval - time.Since(r.scrollSent); r.scrolled != "" || wait > 0 {
+		if r.scrolled == "" {
+			time.AfterFunc(wait, func() {
+				r.mu.Lock()
+				msg := r.scrolled
+				r.scrolled = ""
+				r.scrollSent = time.Now()
+				r.mu.Unlock()
+
+				r.relay(msg)
+			})
+		}
+
+		r.scrolled = msg
+		r.mu.Unlock()
+
+		return
+	}
+
+	r.scrollSent = time.Now()
+	r.mu.Unlock()
+
+	r.relay(msg)
+}
+
+// relay sends msg to all clients, like broadcast but without logging, as
+// sync events are frequent.
+func (r *reloader) relay(msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ch := range r.clients {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package live
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// templateExt is the extension of the templates rendered with -templates.
+const templateExt = ".gohtml"
+
+// renderTemplate executes the template named name with the -data file. All
+// the templates in fsys, outside of ignored directories, are parsed so that
+// they can be used as partials, with name parsed last for its definitions to
+// take precedence.
+func renderTemplate(cfg Config, fsys fs.FS, name string) ([]byte, error) {
+	ignored, err := newIgnorer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+
+	err = fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && file != "." && isIgnored(filepath.Join(cfg.root, filepath.FromSlash(file)), ignored) {
+			return fs.SkipDir
+		}
+
+		if !d.IsDir() && filepath.Ext(file) == templateExt && file != name {
+			files = append(files, file)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files = append(files, name)
+
+	tmpl := template.New("")
+
+	for _, file := range files {
+		src, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tmpl.New(file).Parse(string(src)); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := loadTemplateData(cfg, fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// loadTemplateData reads the -data file, from fsys unless it is an absolute
+// path. A missing file results in no data.
+func loadTemplateData(cfg Config, fsys fs.FS) (any, error) {
+	var (
+		src []byte
+		err error
+	)
+
+	if filepath.IsAbs(cfg.data) {
+		src, err = os.ReadFile(cfg.data)
+	} else {
+		src, err = fs.ReadFile(fsys, filepath.ToSlash(filepath.Clean(cfg.data)))
+	}
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var data any
+
+	if err := json.Unmarshal(src, &data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
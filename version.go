@@ -0,0 +1,34 @@
+package live
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// version describes the build, as recorded by the go command.
+func version() string {
+	var (
+		ver    = "(devel)"
+		commit = "unknown"
+	)
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Version != "" {
+			ver = info.Main.Version
+		}
+
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				commit = s.Value
+			case "vcs.modified":
+				if s.Value == "true" {
+					commit += "-dirty"
+				}
+			}
+		}
+	}
+
+	return fmt.Sprintf("live %s (commit %s, %s %s/%s)", ver, commit, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,170 @@
+package live
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// websocket is an alternative to the SSE endpoint for clients behind proxies
+// that buffer event streams. It implements just enough of RFC 6455 to push
+// text frames to the client and to notice when it goes away.
+func (r *reloader) websocket(w http.ResponseWriter, req *http.Request) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+
+	if key == "" || !headerContains(req.Header, "Connection", "upgrade") ||
+		!headerContains(req.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+
+		return
+	}
+
+	ch, ok := r.add()
+	if !ok {
+		http.Error(w, "too many clients", http.StatusServiceUnavailable)
+
+		return
+	}
+	defer r.remove(ch)
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Hijacked connections keep the deadlines set by the server.
+	_ = conn.SetDeadline(time.Time{})
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		readFrames(rw.Reader)
+	}()
+
+	for {
+		select {
+		case <-done:
+			writeFrame(conn, 0x8, nil)
+
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				writeFrame(conn, 0x8, nil)
+
+				return
+			}
+
+			if err := writeFrame(conn, 0x1, []byte(msg)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readFrames discards client frames until a close frame or a read error.
+func readFrames(r *bufio.Reader) {
+	for {
+		var head [2]byte
+
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return
+		}
+
+		if head[0]&0x0f == 0x8 {
+			return
+		}
+
+		n := uint64(head[1] & 0x7f)
+
+		switch n {
+		case 126:
+			var ext [2]byte
+
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+
+		if head[1]&0x80 != 0 {
+			n += 4
+		}
+
+		if _, err := io.CopyN(io.Discard, r, int64(n)); err != nil {
+			return
+		}
+	}
+}
+
+func writeFrame(conn net.Conn, opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	_, err := conn.Write(append(frame, payload...))
+
+	return err
+}